@@ -0,0 +1,89 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"container/list"
+)
+
+/*
+ * Least recently used cache of decompressed data object payloads, by
+ * offset. Data objects never change once written, so entries stay valid
+ * for the lifetime of the file, even while it grows.
+ */
+type dataCache struct {
+	size int
+
+	// Most recently used first, holding *dataCacheItem
+	order *list.List
+	items map[uint64]*list.Element
+}
+
+type dataCacheItem struct {
+	offset uint64
+	data   []byte
+}
+
+func newDataCache(size int) *dataCache {
+	return &dataCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[uint64]*list.Element),
+	}
+}
+
+func (c *dataCache) get(offset uint64) ([]byte, bool) {
+	e, ok := c.items[offset]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*dataCacheItem).data, true
+}
+
+func (c *dataCache) put(offset uint64, data []byte) {
+	e, ok := c.items[offset]
+	if ok {
+		e.Value.(*dataCacheItem).data = data
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[offset] = c.order.PushFront(&dataCacheItem{offset, data})
+	c.evict()
+}
+
+// Drops the least recently used payloads beyond the size
+func (c *dataCache) evict() {
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*dataCacheItem).offset)
+	}
+}
+
+/*
+ * Keeps the decompressed payloads of up to n compressed data objects, so
+ * that fields shared by many entries, like _SYSTEMD_UNIT, are only
+ * decompressed once. Uncompressed payloads are read in place and never
+ * cached. 0, the default, disables the cache and frees it.
+ *
+ * Each payload may take up to the size given to SetMaxDecompressedSize(),
+ * memory use is bounded by n times that.
+ */
+func (j *SdjournalReader) SetDataCacheSize(n int) {
+	if n <= 0 {
+		j.data_cache = nil
+		return
+	}
+	if j.data_cache == nil {
+		j.data_cache = newDataCache(n)
+		return
+	}
+	j.data_cache.size = n
+	j.data_cache.evict()
+}
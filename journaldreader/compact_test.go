@@ -0,0 +1,62 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"regexp"
+	"testing"
+)
+
+var field_name_pattern = regexp.MustCompile("^[A-Z0-9_]+$")
+
+func read_all(t *testing.T, j *SdjournalReader) []*Entry {
+	t.Helper()
+
+	var r []*Entry
+	for {
+		entry, ok, err := j.NextEntry()
+		if err != nil {
+			t.Fatalf("NextEntry: %v", err)
+		}
+		if !ok {
+			return r
+		}
+		r = append(r, entry)
+	}
+}
+
+/*
+ * The payload of compact data objects starts after the 32 bit tail
+ * fields, at COMPACT_DATA_OBJECT_SIZE, taking it at DATA_OBJECT_SIZE
+ * garbles the field names.
+ */
+func TestCompactPayloads(t *testing.T) {
+	compact := open_fixture(t, "compact.journal")
+	regular := open_fixture(t, "regular.journal")
+	if !compact.IsCompact() || regular.IsCompact() {
+		t.Fatalf("IsCompact() is %v and %v, want true and false", compact.IsCompact(), regular.IsCompact())
+	}
+
+	compact_entries := read_all(t, compact)
+	regular_entries := read_all(t, regular)
+	if len(compact_entries) != FIXTURE_ENTRIES || len(regular_entries) != FIXTURE_ENTRIES {
+		t.Fatalf("Read %d and %d entries, want %d", len(compact_entries), len(regular_entries), FIXTURE_ENTRIES)
+	}
+
+	for i, entry := range compact_entries {
+		for name := range entry.Fields {
+			if !field_name_pattern.MatchString(name) {
+				t.Fatalf("Entry %d has a garbled field name %q", i, name)
+			}
+		}
+		// The first one names the PID of the process stopping journald
+		if i > 0 && entry.Fields["MESSAGE"] != regular_entries[i].Fields["MESSAGE"] {
+			t.Fatalf("Entry %d: MESSAGE %q, want %q", i, entry.Fields["MESSAGE"], regular_entries[i].Fields["MESSAGE"])
+		}
+	}
+}
@@ -0,0 +1,177 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ * The decoded form of a journalctl cursor string:
+ *
+ *     s=<seqnum_id>;i=<seqnum>;b=<boot_id>;m=<monotonic>;t=<realtime>;x=<xor_hash>
+ *
+ * Numbers are hexadecimal. Every part is optional, the has_* fields
+ * record which ones were present.
+ */
+type cursor struct {
+	seqnum_id [16]byte
+	seqnum    uint64
+	boot_id   [16]byte
+	monotonic uint64
+	realtime  uint64
+	xor_hash  uint64
+
+	has_seqnum_id bool
+	has_seqnum    bool
+	has_boot_id   bool
+	has_monotonic bool
+	has_realtime  bool
+	has_xor_hash  bool
+}
+
+func parse_cursor(s string) (cursor, error) {
+	var c cursor
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found || len(key) != 1 {
+			return c, fmt.Errorf("Invalid cursor item %q", part)
+		}
+
+		var err error
+		switch key[0] {
+		case 's':
+			c.seqnum_id, err = ParseID128(value)
+			c.has_seqnum_id = true
+		case 'i':
+			c.seqnum, err = strconv.ParseUint(value, 16, 64)
+			c.has_seqnum = true
+		case 'b':
+			c.boot_id, err = ParseID128(value)
+			c.has_boot_id = true
+		case 'm':
+			c.monotonic, err = strconv.ParseUint(value, 16, 64)
+			c.has_monotonic = true
+		case 't':
+			c.realtime, err = strconv.ParseUint(value, 16, 64)
+			c.has_realtime = true
+		case 'x':
+			c.xor_hash, err = strconv.ParseUint(value, 16, 64)
+			c.has_xor_hash = true
+		default:
+			// Unknown items are ignored, as systemd does
+		}
+		if err != nil {
+			return c, fmt.Errorf("Invalid cursor item %q: %w", part, err)
+		}
+	}
+
+	return c, nil
+}
+
+// Formats a 128-bit id as the 32 lowercase hex digits systemd uses
+func ID128String(id [16]byte) string {
+	return hex.EncodeToString(id[:])
+}
+
+// A 128-bit id such as a boot id or machine id
+type ID128 [16]byte
+
+func (id ID128) String() string {
+	return ID128String(id)
+}
+
+/*
+ * Parses a 128-bit id written as 32 hex digits, or in the UUID format
+ * with dashes such as /proc/sys/kernel/random/boot_id uses, like
+ * sd_id128_from_string() does.
+ */
+func ParseID128(s string) ([16]byte, error) {
+	var id [16]byte
+
+	digits := s
+	if len(s) == 36 && s[8] == '-' && s[13] == '-' && s[18] == '-' && s[23] == '-' {
+		digits = s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	}
+	if len(digits) != 32 {
+		return id, fmt.Errorf("Invalid 128-bit id %q", s)
+	}
+	_, err := hex.Decode(id[:], []byte(digits))
+	if err != nil {
+		return [16]byte{}, fmt.Errorf("Invalid 128-bit id %q", s)
+	}
+	return id, nil
+}
+
+/*
+ * Returns the cursor of the entry most recently returned by Next(), in
+ * the same format journalctl uses. Seeking forgets the entry, until
+ * Next() returns another one there is no cursor.
+ *
+ * The cursor can be persisted and handed to SeekCursor() later to resume
+ * reading, also by journalctl itself.
+ */
+func (j *SdjournalReader) Cursor() (string, error) {
+	if !j.opened {
+		return "", fmt.Errorf("This object hasn't been opened")
+	}
+	if j.last_entry_offset == 0 {
+		return "", fmt.Errorf("No entry has been read yet")
+	}
+
+	h, err := j._loadEntryObject(j.last_entry_offset)
+	if err != nil {
+		return "", err
+	}
+
+	return j._cursor(h), nil
+}
+
+func (j *SdjournalReader) _cursor(h *EntryObject) string {
+	return fmt.Sprintf("s=%s;i=%x;b=%s;m=%x;t=%x;x=%x",
+		ID128String(j.header.seqnum_id), h.seqnum,
+		ID128String(h.boot_id), h.monotonic, h.realtime, h.xor_hash)
+}
+
+/*
+ * Positions the reader so that the next call to Next() returns the entry
+ * identified by the cursor, or the first one after it if that entry is
+ * gone. Call Next() once more to resume after the cursor entry instead,
+ * like journalctl --after-cursor.
+ *
+ * Cursors of this file are located by seqnum. Cursors from another file
+ * fall back to the realtime timestamp.
+ */
+func (j *SdjournalReader) SeekCursor(s string) error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+
+	c, err := parse_cursor(s)
+	if err != nil {
+		return err
+	}
+	j.last_entry_offset = 0
+	j.peeked = nil
+
+	if c.has_seqnum_id && c.seqnum_id == j.header.seqnum_id && c.has_seqnum {
+		return j._seekFirst(func(h *EntryObject) bool {
+			return h.seqnum < c.seqnum
+		})
+	}
+	if c.has_realtime {
+		return j._seekFirst(func(h *EntryObject) bool {
+			return h.realtime < c.realtime
+		})
+	}
+	return fmt.Errorf("Cursor can't be located in this file")
+}
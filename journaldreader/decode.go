@@ -0,0 +1,217 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+/*
+ * Whether the structs can be cast directly onto the file. That needs a
+ * little-endian host and Go laying the structs out like the packed C
+ * structs, which is the case on all common architectures.
+ *
+ * Otherwise every struct is decoded field by field into a copy. The
+ * copies don't follow changes made by journald after they were read.
+ */
+var native_layout = host_is_little_endian() &&
+	unsafe.Offsetof(Header{}.n_data) == HEADER_SIZE &&
+	unsafe.Sizeof(ObjectHeader{}) == OBJECT_HEADER_SIZE &&
+	unsafe.Sizeof(EntryArrayObject{}) == ENTRY_ARRAY_OBJECT_SIZE &&
+	unsafe.Sizeof(EntryObject{}) == ENTRY_OBJECT_SIZE &&
+	unsafe.Sizeof(DataObject{}) == DATA_OBJECT_SIZE &&
+	unsafe.Sizeof(CompactDataObject{}) == COMPACT_DATA_OBJECT_SIZE &&
+	unsafe.Sizeof(FieldObject{}) == FIELD_OBJECT_SIZE &&
+	unsafe.Sizeof(TagObject{}) == TAG_OBJECT_SIZE
+
+func host_is_little_endian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
+
+/*
+ * Reads consecutive little-endian fields. Fields past the end of the
+ * buffer read as zero, like the header fields a smaller header lacks.
+ */
+type le_reader struct {
+	buf []byte
+}
+
+func (r *le_reader) next(n int) []byte {
+	if len(r.buf) < n {
+		r.buf = nil
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *le_reader) u8() uint8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *le_reader) u32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *le_reader) u64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (r *le_reader) bytes(dst []byte) {
+	copy(dst, r.next(len(dst)))
+}
+
+func (r *le_reader) object() ObjectHeader {
+	var o ObjectHeader
+	o.type_ = r.u8()
+	o.flags = r.u8()
+	r.bytes(o.__padding[:])
+	o.size = r.u64()
+	return o
+}
+
+func decode_header(buf []byte) *Header {
+	if native_layout {
+		return (*Header)(unsafe.Pointer(&buf[0]))
+	}
+
+	h := &Header{}
+	r := le_reader{buf}
+	r.bytes(h.signature[:])
+	h.compatible_flags = r.u32()
+	h.incompatible_flags = r.u32()
+	h.state = r.u8()
+	r.bytes(h.__padding[:])
+	r.bytes(h.file_id[:])
+	r.bytes(h.machine_id[:])
+	r.bytes(h.tail_entry_boot_id[:])
+	r.bytes(h.seqnum_id[:])
+	h.header_size = r.u64()
+	h.arena_size = r.u64()
+	h.data_hash_table_offset = r.u64()
+	h.data_hash_table_size = r.u64()
+	h.field_hash_table_offset = r.u64()
+	h.field_hash_table_size = r.u64()
+	h.tail_object_offset = r.u64()
+	h.n_objects = r.u64()
+	h.n_entries = r.u64()
+	h.tail_entry_seqnum = r.u64()
+	h.head_entry_seqnum = r.u64()
+	h.entry_array_offset = r.u64()
+	h.head_entry_realtime = r.u64()
+	h.tail_entry_realtime = r.u64()
+	h.tail_entry_monotonic = r.u64()
+	h.n_data = r.u64()
+	h.n_fields = r.u64()
+	h.n_tags = r.u64()
+	h.n_entry_arrays = r.u64()
+	h.data_hash_chain_depth = r.u64()
+	h.field_hash_chain_depth = r.u64()
+	h.tail_entry_array_offset = r.u32()
+	h.tail_entry_array_n_entries = r.u32()
+	h.tail_entry_offset = r.u64()
+	return h
+}
+
+func decode_object_header(buf []byte) *ObjectHeader {
+	if native_layout {
+		return (*ObjectHeader)(unsafe.Pointer(&buf[0]))
+	}
+
+	r := le_reader{buf}
+	o := r.object()
+	return &o
+}
+
+func decode_entry_array_object(buf []byte) *EntryArrayObject {
+	if native_layout {
+		return (*EntryArrayObject)(unsafe.Pointer(&buf[0]))
+	}
+
+	h := &EntryArrayObject{}
+	r := le_reader{buf}
+	h.object = r.object()
+	h.next_entry_array_offset = r.u64()
+	return h
+}
+
+func decode_entry_object(buf []byte) *EntryObject {
+	if native_layout {
+		return (*EntryObject)(unsafe.Pointer(&buf[0]))
+	}
+
+	h := &EntryObject{}
+	r := le_reader{buf}
+	h.object = r.object()
+	h.seqnum = r.u64()
+	h.realtime = r.u64()
+	h.monotonic = r.u64()
+	r.bytes(h.boot_id[:])
+	h.xor_hash = r.u64()
+	return h
+}
+
+func decode_data_object(buf []byte) *DataObject {
+	if native_layout {
+		return (*DataObject)(unsafe.Pointer(&buf[0]))
+	}
+
+	h := &DataObject{}
+	r := le_reader{buf}
+	h.object = r.object()
+	h.hash = r.u64()
+	h.next_hash_offset = r.u64()
+	h.next_field_offset = r.u64()
+	h.entry_offset = r.u64()
+	h.entry_array_offset = r.u64()
+	h.n_entries = r.u64()
+	return h
+}
+
+func decode_field_object(buf []byte) *FieldObject {
+	if native_layout {
+		return (*FieldObject)(unsafe.Pointer(&buf[0]))
+	}
+
+	h := &FieldObject{}
+	r := le_reader{buf}
+	h.object = r.object()
+	h.hash = r.u64()
+	h.next_hash_offset = r.u64()
+	h.head_data_offset = r.u64()
+	return h
+}
+
+func decode_tag_object(buf []byte) *TagObject {
+	if native_layout {
+		return (*TagObject)(unsafe.Pointer(&buf[0]))
+	}
+
+	h := &TagObject{}
+	r := le_reader{buf}
+	h.object = r.object()
+	h.Seqnum = r.u64()
+	h.Epoch = r.u64()
+	r.bytes(h.Tag[:])
+	return h
+}
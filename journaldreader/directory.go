@@ -0,0 +1,54 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * Finds the journal files under a directory such as /var/log/journal,
+ * descending into the per machine-id subdirectories, and returns them
+ * sorted in chronological order.
+ *
+ * Both active (*.journal) and files journald set aside as corrupted
+ * (*.journal~) are included. Files that can't be read as journals are
+ * skipped, as SortJournalFiles does, and so are unreadable
+ * subdirectories.
+ */
+func OpenDirectory(path string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == path {
+				return err
+			}
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name := d.Name()
+		if strings.HasSuffix(name, ".journal") || strings.HasSuffix(name, ".journal~") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return SortJournalFiles(files), nil
+}
@@ -0,0 +1,90 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Number of payload bytes DumpObject() shows
+const DUMP_PAYLOAD_BYTES = 256
+
+// Formats object flags as the names of the compression bits they set
+func object_flags_string(flags uint8) string {
+	var names []string
+	if flags&OBJECT_COMPRESSED_XZ != 0 {
+		names = append(names, "XZ")
+	}
+	if flags&OBJECT_COMPRESSED_LZ4 != 0 {
+		names = append(names, "LZ4")
+	}
+	if flags&OBJECT_COMPRESSED_ZSTD != 0 {
+		names = append(names, "ZSTD")
+	}
+	if unknown := flags &^ _OBJECT_COMPRESSED_MASK; unknown != 0 {
+		names = append(names, fmt.Sprintf("0x%02x", unknown))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+/*
+ * Describes the object at offset for diagnosing a file that fails to
+ * parse, e.g. with "Unexpected object encountered at N": its type, flags,
+ * size and a hex dump of the first DUMP_PAYLOAD_BYTES bytes after the
+ * object header.
+ *
+ * Nothing is assumed about what is at offset, the dump stops at the end
+ * of the file when the size is bogus and a note says so.
+ */
+func (j *SdjournalReader) DumpObject(offset uint64) (string, error) {
+	if !j.opened {
+		return "", fmt.Errorf("This object hasn't been opened")
+	}
+
+	buf, err := j._slice(offset, OBJECT_HEADER_SIZE)
+	if err != nil {
+		return "", fmt.Errorf("Object at %d is past the end of the file", offset)
+	}
+	h := decode_object_header(buf)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "offset: %d\n", offset)
+	if (offset & 7) != 0 {
+		fmt.Fprintf(&b, "note: not 8-byte aligned\n")
+	}
+	fmt.Fprintf(&b, "type: %s\n", object_type_name(h.type_))
+	fmt.Fprintf(&b, "flags: 0x%02x (%s)\n", h.flags, object_flags_string(h.flags))
+	fmt.Fprintf(&b, "size: %d\n", h.size)
+
+	if h.size < OBJECT_HEADER_SIZE {
+		fmt.Fprintf(&b, "note: size is less than the %d byte object header\n", OBJECT_HEADER_SIZE)
+		return b.String(), nil
+	}
+
+	n := h.size - OBJECT_HEADER_SIZE
+	if avail := j.size - offset - OBJECT_HEADER_SIZE; n > avail {
+		fmt.Fprintf(&b, "note: object runs past the end of the file, %d bytes are missing\n", n-avail)
+		n = avail
+	}
+	if n > DUMP_PAYLOAD_BYTES {
+		n = DUMP_PAYLOAD_BYTES
+	}
+
+	payload, err := j._slice(offset+OBJECT_HEADER_SIZE, n)
+	if err != nil {
+		return "", fmt.Errorf("Object at %d: %w", offset, err)
+	}
+	fmt.Fprintf(&b, "payload (%d of %d bytes):\n", n, h.size-OBJECT_HEADER_SIZE)
+	b.WriteString(hex.Dump(payload))
+	return b.String(), nil
+}
@@ -0,0 +1,112 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"strings"
+	"time"
+)
+
+/*
+ * A single journal entry: its fields together with the metadata stored
+ * in the entry object header.
+ *
+ * Skipped is the number of fields left out because they couldn't be
+ * read, which only happens in lenient mode.
+ *
+ * SourceFile and SourceCursor are only set by a MergedReader annotating
+ * its entries, see SetSourceAnnotation(): the file the entry was read
+ * from and the cursor of the entry in that file.
+ */
+type Entry struct {
+	Fields    map[string]string
+	SeqnumID  [16]byte
+	Seqnum    uint64
+	Realtime  uint64
+	Monotonic uint64
+	BootID    [16]byte
+	Skipped   int
+
+	SourceFile   string
+	SourceCursor string
+}
+
+// A field of an entry as returned by NextOrdered()
+type Field struct {
+	Name  string
+	Value []byte
+}
+
+/*
+ * Returns the monotonic timestamp of the entry together with the boot
+ * it belongs to.
+ *
+ * A monotonic timestamp is only meaningful within the boot that produced
+ * it, so this is the pair journalctl emits as __MONOTONIC_TIMESTAMP and
+ * _BOOT_ID.
+ */
+func (e *Entry) MonotonicWithBoot() (usec uint64, bootID [16]byte) {
+	return e.Monotonic, e.BootID
+}
+
+// Converts a realtime timestamp, microseconds since the epoch, to a time.Time
+func RealtimeToTime(usec uint64) time.Time {
+	return time.UnixMicro(int64(usec))
+}
+
+/*
+ * Converts a monotonic timestamp, microseconds since boot, to a duration.
+ * It is only meaningful together with the boot id.
+ */
+func MonotonicToDuration(usec uint64) time.Duration {
+	return time.Duration(usec) * time.Microsecond
+}
+
+func (e *Entry) RealtimeTime() time.Time {
+	return RealtimeToTime(e.Realtime)
+}
+
+// Time since the boot of the entry, see MonotonicWithBoot()
+func (e *Entry) MonotonicDuration() time.Duration {
+	return MonotonicToDuration(e.Monotonic)
+}
+
+/*
+ * Returns the trusted fields of the entry, the ones with a single
+ * leading underscore such as _PID or _SYSTEMD_UNIT.
+ *
+ * These are added by journald itself and can't be set by the logging
+ * client. Fields with two leading underscores, such as __CURSOR, are
+ * addresses of the entry rather than fields and are left out.
+ */
+func (e *Entry) TrustedFields() map[string]string {
+	r := make(map[string]string)
+	for name, value := range e.Fields {
+		if strings.HasPrefix(name, "_") && !strings.HasPrefix(name, "__") {
+			r[name] = value
+		}
+	}
+	return r
+}
+
+/*
+ * Returns the fields supplied by the logging client, such as MESSAGE or
+ * PRIORITY.
+ *
+ * Any process able to log can set these to arbitrary values, so they
+ * must not be relied upon to identify the sender.
+ */
+func (e *Entry) UserFields() map[string]string {
+	r := make(map[string]string)
+	for name, value := range e.Fields {
+		if !strings.HasPrefix(name, "_") {
+			r[name] = value
+		}
+	}
+	return r
+}
@@ -0,0 +1,221 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+/*
+ * Whether a field can be written as text, following systemd's
+ * utf8_is_printable_newline(): valid UTF-8 without control characters
+ * other than tab, and newline if allowed. The export format doesn't
+ * allow newlines, JSON does.
+ */
+func utf8_is_printable(data []byte, newline bool) bool {
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size <= 1 {
+			return false
+		}
+		if (r < ' ' && r != '\t' && !(newline && r == '\n')) || (r >= 0x7f && r <= 0x9f) {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
+
+/*
+ * Appends the entry at the given offset to buf in the export format, as
+ * journalctl -o export does.
+ */
+func (j *SdjournalReader) _appendExportEntry(buf *bytes.Buffer, offset uint64) error {
+	h, err := j._loadEntryObject(offset)
+	if err != nil {
+		return err
+	}
+
+	buf.WriteString(FIELD_CURSOR + "=")
+	buf.WriteString(j._cursor(h))
+	buf.WriteString("\n" + FIELD_REALTIME_TIMESTAMP + "=")
+	buf.WriteString(strconv.FormatUint(h.realtime, 10))
+	// The monotonic timestamp is only meaningful with its boot id, both
+	// come from the entry object
+	buf.WriteString("\n" + FIELD_MONOTONIC_TIMESTAMP + "=")
+	buf.WriteString(strconv.FormatUint(h.monotonic, 10))
+	buf.WriteString("\n" + FIELD_SEQNUM + "=")
+	buf.WriteString(strconv.FormatUint(h.seqnum, 10))
+	buf.WriteString("\n" + FIELD_SEQNUM_ID + "=")
+	buf.WriteString(ID128String(j.header.seqnum_id))
+	buf.WriteString("\n_BOOT_ID=")
+	buf.WriteString(ID128String(h.boot_id))
+	buf.WriteString("\n")
+
+	_, err = j._readEntryFields(offset, func(name, value []byte) error {
+		// Already written from the entry object
+		if string(name) == "_BOOT_ID" {
+			return nil
+		}
+
+		buf.Write(name)
+		if utf8_is_printable(name, false) && utf8_is_printable(value, false) {
+			buf.WriteByte('=')
+			buf.Write(value)
+		} else {
+			var size [8]byte
+			binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+			buf.WriteByte('\n')
+			buf.Write(size[:])
+			buf.Write(value)
+		}
+		buf.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	buf.WriteByte('\n')
+	return nil
+}
+
+/*
+ * Writes every remaining entry to w in the Journal Export Format, the
+ * same output as journalctl -o export.
+ *
+ * Fields that are not printable UTF-8 or contain newlines are written
+ * in the binary form, with a little endian 64 bit length prefix.
+ *
+ * See https://systemd.io/JOURNAL_EXPORT_FORMATS/
+ */
+func (j *SdjournalReader) WriteExport(w io.Writer) error {
+	return j._writeExport(w)
+}
+
+/*
+ * Like WriteExport() but buffers the output and returns the number of
+ * bytes written, implementing io.WriterTo.
+ *
+ * On errors, reading or writing, whatever is buffered is still flushed
+ * as far as possible and the count covers the bytes w accepted.
+ *
+ * The reader isn't an io.Reader, so io.Copy() doesn't take it, pass it
+ * ExportReader() instead.
+ */
+func (j *SdjournalReader) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	err := j._writeExport(bw)
+	flush_err := bw.Flush()
+	if err == nil {
+		err = flush_err
+	}
+	return cw.n, err
+}
+
+type exportReader struct {
+	j   *SdjournalReader
+	buf bytes.Buffer
+	err error
+}
+
+/*
+ * Returns a reader producing the remaining entries in the export format,
+ * like WriteExport(), for APIs taking an io.Reader. It implements
+ * io.WriterTo through WriteTo(), so io.Copy() writes the entries without
+ * going through Read().
+ *
+ * Entries are read as the output is consumed, so filters apply. Errors
+ * are returned by Read().
+ */
+func (j *SdjournalReader) ExportReader() io.Reader {
+	return &exportReader{j: j}
+}
+
+func (r *exportReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && r.err == nil {
+		offset, err := r.j._next_matching_entry_offset(context.Background())
+		if err != nil {
+			r.err = err
+		} else if offset == 0 {
+			r.err = io.EOF
+		} else {
+			r.err = r.j._appendExportEntry(&r.buf, offset)
+		}
+	}
+
+	if r.buf.Len() > 0 {
+		return r.buf.Read(p)
+	}
+	return 0, r.err
+}
+
+// Writes what Read() has buffered, then the remaining entries
+func (r *exportReader) WriteTo(w io.Writer) (int64, error) {
+	n, err := r.buf.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+	if r.err != nil {
+		if r.err == io.EOF {
+			return n, nil
+		}
+		return n, r.err
+	}
+
+	m, err := r.j.WriteTo(w)
+	if err != nil {
+		r.err = err
+	} else {
+		r.err = io.EOF
+	}
+	return n + m, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (j *SdjournalReader) _writeExport(w io.Writer) error {
+	var buf bytes.Buffer
+
+	for {
+		offset, err := j._next_matching_entry_offset(context.Background())
+		if err != nil {
+			return err
+		}
+		if offset == 0 {
+			return nil
+		}
+
+		buf.Reset()
+		err = j._appendExportEntry(&buf, offset)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+}
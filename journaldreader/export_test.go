@@ -0,0 +1,49 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"testing"
+)
+
+// journalctl 252, which wrote the stored exports, predates these fields
+var export_seqnum_fields = regexp.MustCompile("\n__SEQNUM=[0-9]+\n__SEQNUM_ID=[0-9a-f]{32}\n")
+
+/*
+ * The .export files in testdata are the output of journalctl -o export
+ * for the journal of the same name.
+ */
+func TestWriteExportMatchesJournalctl(t *testing.T) {
+	for _, name := range []string{"compact", "regular"} {
+		t.Run(name, func(t *testing.T) {
+			want, err := os.ReadFile(fixture(name + ".export"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			j := open_fixture(t, name+".journal")
+			var buf bytes.Buffer
+			err = j.WriteExport(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := export_seqnum_fields.ReplaceAll(buf.Bytes(), []byte("\n"))
+			if !bytes.Equal(got, want) {
+				i := 0
+				for i < len(got) && i < len(want) && got[i] == want[i] {
+					i++
+				}
+				t.Fatalf("Export differs from journalctl at byte %d of %d, %q", i, len(want), got[max(i-40, 0):min(i+40, len(got))])
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Same limit systemd-journal-remote applies to a single field
+const EXPORT_DATA_SIZE_MAX = 1024 * 1024 * 768
+
+/*
+ * Reads entries from a stream in the Journal Export Format, as produced
+ * by `journalctl -o export` or consumed by systemd-journal-remote.
+ *
+ * See https://systemd.io/JOURNAL_EXPORT_FORMATS/
+ */
+type ExportReader struct {
+	r *bufio.Reader
+}
+
+func NewExportReader(r io.Reader) *ExportReader {
+	return &ExportReader{r: bufio.NewReader(r)}
+}
+
+/*
+ * Returns the next entry in the stream
+ *
+ * The synthetic double underscore fields are not stored in the field
+ * map but parsed into the entry metadata. _BOOT_ID is a real field, it
+ * is kept in the map and also sets the entry boot id.
+ *
+ * The boolean is false once the end of the stream has been reached.
+ */
+func (e *ExportReader) Next() (*Entry, bool, error) {
+	entry := &Entry{Fields: make(map[string]string)}
+	var c *cursor
+	has_seqnum := false
+	has_seqnum_id := false
+	has_realtime := false
+	has_monotonic := false
+	nfields := 0
+
+	for {
+		line, err := e.r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) != 0 {
+				return nil, false, fmt.Errorf("Unexpected end of stream")
+			}
+			if nfields == 0 {
+				return nil, false, nil
+			}
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		line = line[:len(line)-1]
+		if len(line) == 0 {
+			if nfields == 0 {
+				// Tolerate extra separators between entries
+				continue
+			}
+			break
+		}
+		nfields++
+
+		var name string
+		var value []byte
+
+		if i := bytes.IndexByte(line, '='); i >= 0 {
+			name = string(line[:i])
+			value = line[i+1:]
+		} else {
+			// Binary field: the name is followed by a little endian 64
+			// bit size, the raw data and a newline
+			name = string(line)
+
+			var size [8]byte
+			_, err = io.ReadFull(e.r, size[:])
+			if err != nil {
+				return nil, false, fmt.Errorf("Truncated binary field %s", name)
+			}
+			n := binary.LittleEndian.Uint64(size[:])
+			if n > EXPORT_DATA_SIZE_MAX {
+				return nil, false, fmt.Errorf("Binary field %s is too large (%d bytes)", name, n)
+			}
+			value = make([]byte, n+1)
+			_, err = io.ReadFull(e.r, value)
+			if err != nil {
+				return nil, false, fmt.Errorf("Truncated binary field %s", name)
+			}
+			if value[n] != '\n' {
+				return nil, false, fmt.Errorf("Binary field %s is not terminated by a newline", name)
+			}
+			value = value[:n]
+		}
+
+		switch name {
+		case FIELD_CURSOR:
+			parsed, err := parse_cursor(string(value))
+			if err != nil {
+				return nil, false, err
+			}
+			c = &parsed
+		case FIELD_REALTIME_TIMESTAMP:
+			entry.Realtime, err = strconv.ParseUint(string(value), 10, 64)
+			has_realtime = true
+		case FIELD_MONOTONIC_TIMESTAMP:
+			entry.Monotonic, err = strconv.ParseUint(string(value), 10, 64)
+			has_monotonic = true
+		case FIELD_SEQNUM:
+			entry.Seqnum, err = strconv.ParseUint(string(value), 10, 64)
+			has_seqnum = true
+		case FIELD_SEQNUM_ID:
+			entry.SeqnumID, err = ParseID128(string(value))
+			has_seqnum_id = true
+		case "_BOOT_ID":
+			entry.BootID, err = ParseID128(string(value))
+			entry.Fields[name] = string(value)
+		default:
+			if !IsSyntheticField(name) {
+				entry.Fields[name] = string(value)
+			}
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid value for %s: %w", name, err)
+		}
+	}
+
+	// Older exporters only carry the seqnum inside the cursor
+	if c != nil {
+		if !has_seqnum && c.has_seqnum {
+			entry.Seqnum = c.seqnum
+		}
+		if !has_seqnum_id && c.has_seqnum_id {
+			entry.SeqnumID = c.seqnum_id
+		}
+		if !has_realtime && c.has_realtime {
+			entry.Realtime = c.realtime
+		}
+		if !has_monotonic && c.has_monotonic {
+			entry.Monotonic = c.monotonic
+		}
+		if _, ok := entry.Fields["_BOOT_ID"]; !ok && c.has_boot_id {
+			entry.BootID = c.boot_id
+		}
+	}
+
+	return entry, true, nil
+}
@@ -0,0 +1,161 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Synthetic fields used by the journal export and JSON formats.
+ *
+ * They are derived from the entry object header rather than stored as
+ * data objects, so they never appear in a journal file. Exporters emit
+ * them and importers map them back to the entry metadata instead of
+ * treating them as data fields.
+ */
+const FIELD_CURSOR = "__CURSOR"
+const FIELD_REALTIME_TIMESTAMP = "__REALTIME_TIMESTAMP"
+const FIELD_MONOTONIC_TIMESTAMP = "__MONOTONIC_TIMESTAMP"
+const FIELD_SEQNUM = "__SEQNUM"
+const FIELD_SEQNUM_ID = "__SEQNUM_ID"
+
+var synthetic_fields = []string{
+	FIELD_CURSOR,
+	FIELD_REALTIME_TIMESTAMP,
+	FIELD_MONOTONIC_TIMESTAMP,
+	FIELD_SEQNUM,
+	FIELD_SEQNUM_ID,
+}
+
+/*
+ * Returns the synthetic fields this package writes in exports, a copy
+ * callers may change. Whether a name is synthetic is decided by
+ * IsSyntheticField(), not by this list.
+ */
+func SyntheticFields() []string {
+	return slices.Clone(synthetic_fields)
+}
+
+/*
+ * Reports whether the field name is reserved for synthetic fields. This
+ * is the rule exporters and importers go by.
+ *
+ * journald never stores fields with a double underscore prefix, so any
+ * such name is synthetic, including ones SyntheticFields() doesn't list,
+ * like those of newer journalctl versions.
+ */
+func IsSyntheticField(name string) bool {
+	return strings.HasPrefix(name, "__")
+}
+
+// The longest field name journald accepts
+const FIELD_NAME_MAX = 64
+
+/*
+ * Reports whether journald would accept the field name: 1 to 64
+ * characters out of A-Z, 0-9 and '_', not starting with a digit.
+ *
+ * Names starting with '_' are trusted fields, only journald itself sets
+ * them.
+ */
+func ValidFieldName(name string) bool {
+	if name == "" || len(name) > FIELD_NAME_MAX {
+		return false
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * Makes reading an entry fail on field names journald wouldn't accept,
+ * see ValidFieldName(). They can only come from corruption or from a
+ * file not written by journald. In lenient mode these fields are skipped
+ * instead.
+ */
+func (j *SdjournalReader) SetStrictFieldNames(strict bool) {
+	j.strict_field_names = strict
+}
+
+/*
+ * Makes Next() and NextRaw() add the synthetic fields to every entry,
+ * like journalctl -o json does, so their output can replace it.
+ */
+func (j *SdjournalReader) IncludeMetaFields(include bool) {
+	j.include_meta = include
+}
+
+// Calls fn with the synthetic fields of the entry at the given offset
+func (j *SdjournalReader) _metaFields(offset uint64, fn func(name, value string)) error {
+	h, err := j._loadEntryObject(offset)
+	if err != nil {
+		return err
+	}
+
+	fn(FIELD_CURSOR, j._cursor(h))
+	fn(FIELD_REALTIME_TIMESTAMP, strconv.FormatUint(h.realtime, 10))
+	fn(FIELD_MONOTONIC_TIMESTAMP, strconv.FormatUint(h.monotonic, 10))
+	fn(FIELD_SEQNUM, strconv.FormatUint(h.seqnum, 10))
+	fn(FIELD_SEQNUM_ID, ID128String(j.header.seqnum_id))
+	return nil
+}
+
+/*
+ * What the maps returned by Next(), NextRaw() and NextEntry() hold for a
+ * field repeated in an entry, e.g. several GROUP= lines, see
+ * SetDuplicateFieldPolicy().
+ *
+ * journald stores every value. journalctl -o json turns repeated fields
+ * into arrays, while sd_journal_get_data() returns the first value in
+ * on-disk order. NextOrdered() returns them all.
+ */
+type DuplicateFieldPolicy int
+
+const (
+	// The last value on disk is kept, the default
+	DUPLICATE_KEEP_LAST DuplicateFieldPolicy = iota
+	// The first value on disk is kept, like sd_journal_get_data()
+	DUPLICATE_KEEP_FIRST
+	// The values are joined with newlines, in on-disk order
+	DUPLICATE_JOIN
+)
+
+/*
+ * Sets how repeated fields end up in the maps returned, the last value
+ * is kept by default.
+ */
+func (j *SdjournalReader) SetDuplicateFieldPolicy(policy DuplicateFieldPolicy) {
+	j.duplicate_policy = policy
+}
+
+// Stores a field into an entry map, following the duplicate field policy
+func put_field[V string | []byte](fields map[string]V, policy DuplicateFieldPolicy, name string, value V) {
+	old, ok := fields[name]
+	if !ok {
+		fields[name] = value
+		return
+	}
+
+	switch policy {
+	case DUPLICATE_KEEP_FIRST:
+	case DUPLICATE_JOIN:
+		fields[name] = V(string(old) + "\n" + string(value))
+	default:
+		fields[name] = value
+	}
+}
@@ -0,0 +1,31 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"testing"
+)
+
+func TestSyntheticFields(t *testing.T) {
+	fields := SyntheticFields()
+	for _, name := range fields {
+		if !IsSyntheticField(name) {
+			t.Fatalf("%s is listed but IsSyntheticField() says it isn't synthetic", name)
+		}
+	}
+
+	// Callers get a copy
+	fields[0] = "MESSAGE"
+	if SyntheticFields()[0] != FIELD_CURSOR {
+		t.Fatalf("Changing the returned slice changed the list")
+	}
+
+	if IsSyntheticField("_BOOT_ID") || IsSyntheticField("MESSAGE") {
+		t.Fatalf("Stored fields taken as synthetic")
+	}
+}
@@ -0,0 +1,203 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unsafe"
+)
+
+// How often Follow() looks for new entries once it reached the tail
+const FOLLOW_POLL_INTERVAL = 250 * time.Millisecond
+
+/*
+ * Sends every entry to out, like Next(), and then keeps waiting for new
+ * entries to be appended, like journalctl -f. It returns the context
+ * error once ctx is cancelled, or the first error encountered.
+ *
+ * The file is remapped when it grows. When journald rotates it, which is
+ * detected by a different file_id at the path given to Open(), the rest
+ * of the old file is read and following continues with the new one. The
+ * filters set on the reader are kept.
+ *
+ * Only readers that mapped an uncompressed file with Open() can be
+ * followed, and they must not share their mapping with other readers.
+ */
+func (j *SdjournalReader) Follow(ctx context.Context, out chan<- map[string]string) error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+	if j.mapping == nil {
+		return fmt.Errorf("Only mapped journal files can be followed")
+	}
+
+	for {
+		rotated, err := j._followRotated()
+		if err != nil {
+			return err
+		}
+
+		// A rotated file is final, read what was appended before that
+		err = j._followGrow()
+		if err != nil {
+			return err
+		}
+
+		err = j._followDrain(ctx, out)
+		if err != nil {
+			return err
+		}
+
+		if rotated {
+			err = j._followReopen()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(FOLLOW_POLL_INTERVAL):
+		}
+	}
+}
+
+// Sends the entries available so far to out
+func (j *SdjournalReader) _followDrain(ctx context.Context, out chan<- map[string]string) error {
+	for {
+		entry, ok, err := j.NextContext(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- entry:
+		}
+	}
+}
+
+/*
+ * Remaps the file if it grew, keeping the iterator position. Without
+ * native_layout the header and entry array are decoded copies, they are
+ * read again to see what journald changed.
+ */
+func (j *SdjournalReader) _followGrow() error {
+	// Values that were missing may have been written since
+	j.match_terms = nil
+
+	info, err := j.mapping.fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() > int64(j.size) {
+		data, err := j.mapping.remap()
+		if err != nil {
+			return err
+		}
+		j.data = data
+		j.size = uint64(len(data))
+	} else if native_layout {
+		return nil
+	}
+
+	// Everything pointing into the old mapping has to be loaded again
+	err = j._loadHeader()
+	if err != nil {
+		return err
+	}
+	if j.entryarray != nil {
+		i := j.array_iterator
+		err = j._loadEntryArrayObject(j.entry_array_offset)
+		if err != nil {
+			return err
+		}
+		j.array_iterator = i
+	}
+	return nil
+}
+
+/*
+ * Reports whether the file at the path has been replaced by a new
+ * journal. A missing or incomplete file is not reported, journald may be
+ * in the middle of creating it.
+ */
+func (j *SdjournalReader) _followRotated() (bool, error) {
+	fd, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer fd.Close()
+
+	buf := make([]byte, unsafe.Sizeof(Header{}))
+	_, err = fd.ReadAt(buf[:HEADER_SIZE], 0)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h := decode_header(buf)
+	if string(h.signature[:]) != "LPKSHHRH" {
+		return false, nil
+	}
+	return h.file_id != j.header.file_id, nil
+}
+
+// Replaces the reader with one for the new file at the path
+func (j *SdjournalReader) _followReopen() error {
+	n := SdjournalReader{
+		allow_unknown_flags:   j.allow_unknown_flags,
+		max_decompressed_size: j.max_decompressed_size,
+	}
+	err := n.Open(j.path)
+	if err != nil {
+		return err
+	}
+
+	n.matches = j.matches
+	n.disjunctions = j.disjunctions
+	n.max_priority = j.max_priority
+	n.has_max_priority = j.has_max_priority
+	n.match_absent = j.match_absent
+	n.field_filter = j.field_filter
+	n.boot_filter = j.boot_filter
+	n.has_boot_filter = j.has_boot_filter
+	n.lenient = j.lenient
+	n.include_meta = j.include_meta
+	n.duplicate_policy = j.duplicate_policy
+	n.strict_field_names = j.strict_field_names
+	n.verify_xor_hash = j.verify_xor_hash
+	n.stats = j.stats
+	if j.data_cache != nil {
+		// Offsets are those of the new file, nothing can be reused
+		n.data_cache = newDataCache(j.data_cache.size)
+	}
+	// Strings don't depend on the file, keep what was seen so far
+	n.interner = j.interner
+	n.errors = j.errors
+
+	err = j.Close()
+	*j = n
+	return err
+}
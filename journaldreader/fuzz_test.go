@@ -0,0 +1,67 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Bound on the entries read per input, corrupt files may loop
+const FUZZ_MAX_ENTRIES = 1000
+
+/*
+ * Opens arbitrary bytes as a journal, mapped from a file and through
+ * OpenReaderAt(), and reads all the entries. Errors are expected, panics
+ * are not.
+ */
+func FuzzOpen(f *testing.F) {
+	for _, name := range []string{"regular.journal", "compact.journal"} {
+		data, err := os.ReadFile(fixture(name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+		// Cut within the header, the hash tables and the entries
+		for _, n := range []int{0, 8, HEADER_SIZE - 1, HEADER_SIZE, 264, 4096, len(data) / 2, len(data) - 1} {
+			f.Add(data[:n])
+		}
+	}
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(dir, "fuzz.journal")
+		err := os.WriteFile(path, data, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		j := &SdjournalReader{}
+		if j.Open(path) == nil {
+			fuzz_read(j)
+		}
+		j.Close()
+
+		j, err = OpenReaderAt(bytes.NewReader(data), int64(len(data)))
+		if err == nil {
+			fuzz_read(j)
+			j.Close()
+		}
+	})
+}
+
+func fuzz_read(j *SdjournalReader) {
+	for i := 0; i < FUZZ_MAX_ENTRIES; i++ {
+		_, ok, err := j.Next()
+		if err != nil || !ok {
+			return
+		}
+	}
+}
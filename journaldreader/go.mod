@@ -1,10 +1,9 @@
 module github.com/appgate/journaldreader/journaldreader
 
-go 1.22.6
+go 1.23
 
 require (
 	github.com/edsrzf/mmap-go v1.1.0
 	github.com/klauspost/compress v1.17.9
+	golang.org/x/sys v0.1.0
 )
-
-require golang.org/x/sys v0.1.0 // indirect
@@ -0,0 +1,209 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * The hash functions used by journald for its hash tables.
+ *
+ * jenkins_hash64 is lookup3's hashlittle2() by Bob Jenkins (public
+ * domain), combined into 64 bits the way systemd's jenkins_hash64() does.
+ *
+ * siphash24 is SipHash-2-4 by Jean-Philippe Aumasson and Daniel J.
+ * Bernstein (CC0), as used for journals with HEADER_INCOMPATIBLE_KEYED_HASH.
+ *
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+func jenkins_hash64(data []byte) uint64 {
+	a := 0xdeadbeef + uint32(len(data))
+	b := a
+	c := a
+
+	k := data
+	for len(k) > 12 {
+		a += binary.LittleEndian.Uint32(k[0:4])
+		b += binary.LittleEndian.Uint32(k[4:8])
+		c += binary.LittleEndian.Uint32(k[8:12])
+
+		// mix()
+		a -= c
+		a ^= bits.RotateLeft32(c, 4)
+		c += b
+		b -= a
+		b ^= bits.RotateLeft32(a, 6)
+		a += c
+		c -= b
+		c ^= bits.RotateLeft32(b, 8)
+		b += a
+		a -= c
+		a ^= bits.RotateLeft32(c, 16)
+		c += b
+		b -= a
+		b ^= bits.RotateLeft32(a, 19)
+		a += c
+		c -= b
+		c ^= bits.RotateLeft32(b, 4)
+		b += a
+
+		k = k[12:]
+	}
+
+	if len(k) == 0 {
+		// Zero length tails require no final mixing
+		return uint64(c)<<32 | uint64(b)
+	}
+
+	var tail [12]byte
+	copy(tail[:], k)
+	a += binary.LittleEndian.Uint32(tail[0:4])
+	b += binary.LittleEndian.Uint32(tail[4:8])
+	c += binary.LittleEndian.Uint32(tail[8:12])
+
+	// final()
+	c ^= b
+	c -= bits.RotateLeft32(b, 14)
+	a ^= c
+	a -= bits.RotateLeft32(c, 11)
+	b ^= a
+	b -= bits.RotateLeft32(a, 25)
+	c ^= b
+	c -= bits.RotateLeft32(b, 16)
+	a ^= c
+	a -= bits.RotateLeft32(c, 4)
+	b ^= a
+	b -= bits.RotateLeft32(a, 14)
+	c ^= b
+	c -= bits.RotateLeft32(b, 24)
+
+	return uint64(c)<<32 | uint64(b)
+}
+
+func siphash24(data []byte, key [16]byte) uint64 {
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+
+	k := data
+	for len(k) >= 8 {
+		m := binary.LittleEndian.Uint64(k[0:8])
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+		k = k[8:]
+	}
+
+	var tail [8]byte
+	copy(tail[:], k)
+	m := binary.LittleEndian.Uint64(tail[:]) | uint64(len(data))<<56
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+/*
+ * Hashes a payload with the algorithm this file uses for its hash tables.
+ *
+ * The algorithm and the SipHash key (the file_id) are properties of each
+ * file, so a directory spanning the systemd 246 upgrade mixes keyed and
+ * non-keyed files. Hashes must therefore never be computed once and
+ * reused across readers; every lookup goes through the reader that owns
+ * the file.
+ */
+func (j *SdjournalReader) hashPayload(data []byte) uint64 {
+	if (j.header.incompatible_flags & HEADER_INCOMPATIBLE_KEYED_HASH) != 0 {
+		return siphash24(data, j.header.file_id)
+	}
+	return jenkins_hash64(data)
+}
+
+/*
+ * Returns the hash the data object at the given offset, with the given
+ * payload, contributes to the xor_hash of the entries referencing it.
+ *
+ * That is the hash stored in the data object, except in files with keyed
+ * hashes: the SipHash depends on the file_id, so journald uses the
+ * Jenkins hash of the payload to keep xor_hash comparable across files.
+ */
+func (j *SdjournalReader) _entryItemHash(offset uint64, payload []byte) (uint64, error) {
+	if (j.header.incompatible_flags & HEADER_INCOMPATIBLE_KEYED_HASH) != 0 {
+		return jenkins_hash64(payload), nil
+	}
+
+	h, _, err := j._loadDataObject(offset)
+	if err != nil {
+		return 0, err
+	}
+	return h.hash, nil
+}
+
+/*
+ * Compares the xor_hash of the entry at the given offset with the XOR of
+ * the hashes of its data objects.
+ */
+func (j *SdjournalReader) _checkXorHash(offset uint64, xor_hash uint64) error {
+	h, err := j._loadEntryObject(offset)
+	if err != nil {
+		return err
+	}
+	if h.xor_hash == xor_hash {
+		return nil
+	}
+
+	err = fmt.Errorf("Entry at %d has xor_hash %016x, its data objects hash to %016x", offset, h.xor_hash, xor_hash)
+	if !j.lenient {
+		return err
+	}
+	j.errors = append(j.errors, err)
+	return nil
+}
+
+/*
+ * Makes reading an entry check its xor_hash, the XOR of the hashes of
+ * its data objects. This catches entries whose data offsets were
+ * corrupted into pointing at other data objects. A mismatch fails the
+ * entry, in lenient mode it is only recorded in Errors().
+ *
+ * The check runs once all fields were read, so callbacks such as
+ * NextZeroCopy()'s may already have seen the fields of a failing entry.
+ */
+func (j *SdjournalReader) SetVerifyXorHash(verify bool) {
+	j.verify_xor_hash = verify
+}
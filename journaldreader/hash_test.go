@@ -0,0 +1,79 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"testing"
+)
+
+// file_id of testdata/compact.journal, the SipHash key of its hashes
+var compact_file_id = [16]byte{
+	0x12, 0x2c, 0xf1, 0x80, 0x17, 0x82, 0x42, 0x75,
+	0xb8, 0x1c, 0xfa, 0x14, 0xe4, 0xcd, 0x62, 0xcf,
+}
+
+/*
+ * Hashes of data objects as journald stored them in the fixtures, Jenkins
+ * lookup3 in regular.journal and SipHash-2-4 in compact.journal. The
+ * payload lengths cover the tails of both algorithms.
+ */
+var hash_vectors = []struct {
+	payload string
+	jenkins uint64
+	siphash uint64
+}{
+	{"PRIORITY=6", 0x80f09f19808d26a3, 0x1a1bbabc62b88f20},
+	{"_HOSTNAME=vm", 0x1a04a94bc02a8f8f, 0x6aaf37f914a2df50},
+	{"_TRANSPORT=kernel", 0x5837fe9dc1c91f32, 0x9eb4f1c24ca572f9},
+	{"SYSLOG_FACILITY=5", 0xb1a5587f8cbd5eb9, 0x692ec3094fedba2b},
+	{"_RUNTIME_SCOPE=system", 0x0c02a63624e3bc0c, 0x38252d329ca4e080},
+	{"SYSLOG_IDENTIFIER=systemd-journald", 0xef692f3a6c10c105, 0x7089013267672d0a},
+}
+
+func TestJenkinsHash(t *testing.T) {
+	for _, v := range hash_vectors {
+		h := jenkins_hash64([]byte(v.payload))
+		if h != v.jenkins {
+			t.Errorf("jenkins_hash64(%q) = %#x, want %#x", v.payload, h, v.jenkins)
+		}
+	}
+}
+
+func TestSiphash(t *testing.T) {
+	for _, v := range hash_vectors {
+		h := siphash24([]byte(v.payload), compact_file_id)
+		if h != v.siphash {
+			t.Errorf("siphash24(%q) = %#x, want %#x", v.payload, h, v.siphash)
+		}
+	}
+}
+
+// hashPayload() picks the algorithm, and key, of each file
+func TestHashPayload(t *testing.T) {
+	tests := []struct {
+		name  string
+		keyed bool
+	}{
+		{"regular.journal", false},
+		{"compact.journal", true},
+	}
+
+	for _, test := range tests {
+		j := open_fixture(t, test.name)
+		for _, v := range hash_vectors {
+			want := v.jenkins
+			if test.keyed {
+				want = v.siphash
+			}
+			h := j.hashPayload([]byte(v.payload))
+			if h != want {
+				t.Errorf("%s: hashPayload(%q) = %#x, want %#x", test.name, v.payload, h, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+// Number of distinct strings kept before the interning table starts over
+const STRING_INTERN_MAX_ENTRIES = 1 << 16
+
+/*
+ * Table of the field names and values seen so far, returning the same
+ * string for equal bytes. Looking up a []byte converted in the index
+ * expression doesn't allocate, so only new strings do.
+ */
+type stringInterner struct {
+	strings map[string]string
+}
+
+func newStringInterner() *stringInterner {
+	return &stringInterner{strings: make(map[string]string)}
+}
+
+func (t *stringInterner) intern(b []byte) string {
+	s, ok := t.strings[string(b)]
+	if ok {
+		return s
+	}
+
+	// High cardinality values, like MESSAGE, would grow the table forever
+	if len(t.strings) >= STRING_INTERN_MAX_ENTRIES {
+		clear(t.strings)
+	}
+	s = string(b)
+	t.strings[s] = s
+	return s
+}
+
+// Converts a field name or value read from the file to a string
+func (j *SdjournalReader) _string(b []byte) string {
+	if j.interner == nil {
+		return string(b)
+	}
+	return j.interner.intern(b)
+}
+
+/*
+ * Makes the maps returned by Next() and EntryAt() share one string for
+ * equal field names and values, so journals repeating the same values
+ * over millions of entries don't hold a copy per entry. Each field costs
+ * a map lookup instead of an allocation.
+ *
+ * The table holds up to STRING_INTERN_MAX_ENTRIES strings and is emptied
+ * when full, so values that never repeat only cost the lookup. Disabling
+ * interning frees the table.
+ */
+func (j *SdjournalReader) SetStringInterning(enable bool) {
+	if !enable {
+		j.interner = nil
+		return
+	}
+	if j.interner == nil {
+		j.interner = newStringInterner()
+	}
+}
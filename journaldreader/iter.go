@@ -0,0 +1,56 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"iter"
+)
+
+/*
+ * Returns an iterator over the remaining entries, as returned by Next():
+ *
+ *	for entry, err := range j.All() {
+ *		...
+ *	}
+ *
+ * An error is yielded once, with a nil entry, and ends the iteration.
+ * Breaking out of the loop leaves the reader after the last entry
+ * yielded, so Next() or All() continue from there.
+ */
+func (j *SdjournalReader) All() iter.Seq2[map[string]string, error] {
+	return func(yield func(map[string]string, error) bool) {
+		for {
+			entry, ok, err := j.Next()
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !ok || !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+/*
+ * Reads all remaining entries into memory, as returned by Next(), so
+ * only suitable for small journals. Matches and filters apply.
+ *
+ * On error the entries read until then are returned with it.
+ */
+func (j *SdjournalReader) ReadAll() ([]map[string]string, error) {
+	var r []map[string]string
+
+	for entry, err := range j.All() {
+		if err != nil {
+			return r, err
+		}
+		r = append(r, entry)
+	}
+	return r, nil
+}
@@ -45,21 +45,40 @@
 package journaldreader
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"github.com/edsrzf/mmap-go"
 	"github.com/klauspost/compress/zstd"
+	"io"
+	"maps"
+	"math"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"unsafe"
 )
 
+// Files starting with this are zstd compressed as a whole
+var zstd_file_magic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
 const HEADER_SIZE = 208            //struct.calcsize('<8s 2I B 7x 16s 16s 16s 16s 15Q')
 const OBJECT_HEADER_SIZE = 16      //struct.calcsize('<2B 6x Q')
 const ENTRY_ARRAY_OBJECT_SIZE = 24 //OBJECT_HEADER_SIZE + struct.calcsize('<2B 6x Q Q')
 const ENTRY_OBJECT_SIZE = 64       //OBJECT_HEADER_SIZE + struct.calcsize('<3Q 16s Q')
 const DATA_OBJECT_SIZE = 64        //OBJECT_HEADER_SIZE + struct.calcsize('<6Q')
+const FIELD_OBJECT_SIZE = 40       //OBJECT_HEADER_SIZE + struct.calcsize('<3Q')
+const TAG_OBJECT_SIZE = 64         //OBJECT_HEADER_SIZE + struct.calcsize('<2Q 32s')
+
+const TAG_LENGTH = 256 / 8 // HMAC-SHA256
+
+const COMPACT_DATA_OBJECT_SIZE = 72 //DATA_OBJECT_SIZE + struct.calcsize('<2I')
+const HASH_ITEM_SIZE = 16           //struct.calcsize('<2Q')
+
+// Hash chains longer than this make journald rotate the file
+const HASH_CHAIN_DEPTH_MAX = 100
 
 const OBJECT_UNUSED = 0 // also serves as "any type" or "additional category"
 const OBJECT_DATA = 1
@@ -77,11 +96,21 @@ const OBJECT_COMPRESSED_LZ4 = 1 << 1
 const OBJECT_COMPRESSED_ZSTD = 1 << 2
 const _OBJECT_COMPRESSED_MASK = OBJECT_COMPRESSED_XZ | OBJECT_COMPRESSED_LZ4 | OBJECT_COMPRESSED_ZSTD
 
+const STATE_OFFLINE = 0  // closed cleanly
+const STATE_ONLINE = 1   // being written to, or not closed cleanly
+const STATE_ARCHIVED = 2 // rotated, never written again
+
+const HEADER_COMPATIBLE_SEALED = 1 << 0
+const HEADER_COMPATIBLE_TAIL_ENTRY_BOOT_ID = 1 << 1 // tail_entry_boot_id is really the boot of the tail entry
+const HEADER_COMPATIBLE_SEALED_CONTINUOUS = 1 << 2
+
 const HEADER_INCOMPATIBLE_COMPRESSED_XZ = 1 << 0
 const HEADER_INCOMPATIBLE_COMPRESSED_LZ4 = 1 << 1
 const HEADER_INCOMPATIBLE_KEYED_HASH = 1 << 2
 const HEADER_INCOMPATIBLE_COMPRESSED_ZSTD = 1 << 3
 const HEADER_INCOMPATIBLE_COMPACT = 1 << 4
+const _HEADER_INCOMPATIBLE_SUPPORTED = HEADER_INCOMPATIBLE_COMPRESSED_XZ | HEADER_INCOMPATIBLE_COMPRESSED_LZ4 |
+	HEADER_INCOMPATIBLE_KEYED_HASH | HEADER_INCOMPATIBLE_COMPRESSED_ZSTD | HEADER_INCOMPATIBLE_COMPACT
 
 type Header struct {
 	signature               [8]byte
@@ -108,6 +137,20 @@ type Header struct {
 	head_entry_realtime     uint64
 	tail_entry_realtime     uint64
 	tail_entry_monotonic    uint64
+	/* Added in 187 */
+	n_data   uint64
+	n_fields uint64
+	/* Added in 189 */
+	n_tags         uint64
+	n_entry_arrays uint64
+	/* Added in 246 */
+	data_hash_chain_depth  uint64
+	field_hash_chain_depth uint64
+	/* Added in 252 */
+	tail_entry_array_offset    uint32
+	tail_entry_array_n_entries uint32
+	/* Added in 254 */
+	tail_entry_offset uint64
 }
 
 type ObjectHeader struct {
@@ -117,73 +160,268 @@ type ObjectHeader struct {
 	size      uint64
 }
 
+var object_type_names = map[uint8]string{
+	OBJECT_UNUSED:           "unused",
+	OBJECT_DATA:             "data",
+	OBJECT_FIELD:            "field",
+	OBJECT_ENTRY:            "entry",
+	OBJECT_DATA_HASH_TABLE:  "data hash table",
+	OBJECT_FIELD_HASH_TABLE: "field hash table",
+	OBJECT_ENTRY_ARRAY:      "entry array",
+	OBJECT_TAG:              "tag",
+}
+
+func object_type_name(type_ uint8) string {
+	name, ok := object_type_names[type_]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", type_)
+	}
+	return name
+}
+
+/*
+ * Checks that the size of an object is large enough for its type and
+ * that the object doesn't extend past the end of the file, so slices
+ * computed from the size stay in bounds on corrupt files.
+ */
+func (j *SdjournalReader) _checkObjectSize(offset uint64, h *ObjectHeader, min_size uint64) error {
+	if h.size < min_size {
+		return fmt.Errorf("The %s object at %d has size %d, less than the minimum of %d", object_type_name(h.type_), offset, h.size, min_size)
+	}
+	if offset > j.size || h.size > j.size-offset {
+		return fmt.Errorf("The %s object at %d with size %d runs past the end of the file", object_type_name(h.type_), offset, h.size)
+	}
+	return nil
+}
+
+/*
+ * Calls fn with the offset and header of every object in the file, in
+ * file order, from the end of the header up to the tail object.
+ *
+ * Objects are laid out back to back, each aligned to 8 bytes, so this
+ * finds objects that nothing links to, like tags.
+ */
+func (j *SdjournalReader) _walkObjects(fn func(offset uint64, h *ObjectHeader) error) error {
+	tail := j.header.tail_object_offset
+
+	offset := j.header.header_size
+	for tail != 0 && offset <= tail {
+		buf, err := j._slice(offset, OBJECT_HEADER_SIZE)
+		if err != nil {
+			return fmt.Errorf("Object at %d is past the end of the file", offset)
+		}
+		h := decode_object_header(buf)
+
+		err = j._checkObjectSize(offset, h, OBJECT_HEADER_SIZE)
+		if err != nil {
+			return err
+		}
+
+		err = fn(offset, h)
+		if err != nil {
+			return err
+		}
+
+		offset += (h.size + 7) &^ 7
+	}
+	return nil
+}
+
+/*
+ * Calls fn with the offset, type and size of every object in the file,
+ * in file order, for tools inspecting the raw structure. The types are
+ * the OBJECT_* constants, sizes exclude the padding to 8 bytes.
+ *
+ * Walking stops at the first error returned by fn, which is returned.
+ */
+func (j *SdjournalReader) WalkObjects(fn func(offset uint64, typ uint8, size uint64) error) error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+
+	return j._walkObjects(func(offset uint64, h *ObjectHeader) error {
+		return fn(offset, h.type_, h.size)
+	})
+}
+
 type EntryArrayObject struct {
 	object                  ObjectHeader
 	next_entry_array_offset uint64
 }
 
-func (j *SdjournalReader) _loadEntryArrayObject(offset uint64) error {
+/*
+ * Returns the entry array object at the given offset along with the
+ * bytes holding its items.
+ */
+func (j *SdjournalReader) _entryArrayAt(offset uint64) (*EntryArrayObject, []byte, error) {
 
 	if (offset & 7) != 0 {
-		return fmt.Errorf("Unaligned offset")
+		return nil, nil, fmt.Errorf("Unaligned offset")
 	}
 
-	if uint64(len(j.data))-offset < ENTRY_ARRAY_OBJECT_SIZE {
-		return fmt.Errorf("EOF")
+	buf, err := j._slice(offset, ENTRY_ARRAY_OBJECT_SIZE)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	h := (*EntryArrayObject)(unsafe.Pointer(&j.data[offset]))
+	h := decode_entry_array_object(buf)
 
 	if h.object.type_ != OBJECT_ENTRY_ARRAY {
-		return fmt.Errorf("Unexpected object encountered at %d", offset)
+		return nil, nil, fmt.Errorf("Unexpected object encountered at %d", offset)
+	}
+
+	err = j._checkObjectSize(offset, &h.object, ENTRY_ARRAY_OBJECT_SIZE)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items, err := j._slice(offset+ENTRY_ARRAY_OBJECT_SIZE, h.object.size-ENTRY_ARRAY_OBJECT_SIZE)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h, items, nil
+}
+
+/*
+ * Returns the offset of the array following the one at the given offset
+ * in its chain, 0 at the end of the chain.
+ *
+ * journald only appends arrays, so chains move forward in the file. A
+ * link pointing back can only come from corruption and could make the
+ * chain a cycle, it is an error.
+ */
+func _nextEntryArray(offset uint64, h *EntryArrayObject) (uint64, error) {
+	next := h.next_entry_array_offset
+	if next != 0 && next <= offset {
+		return 0, fmt.Errorf("Entry array chain has a cycle, jumps back from %d to %d", offset, next)
+	}
+	return next, nil
+}
+
+func (j *SdjournalReader) _loadEntryArrayObject(offset uint64) error {
+	h, items, err := j._entryArrayAt(offset)
+	if err != nil {
+		return err
 	}
 
 	j.array_iterator = 0
 	j.entry_array_offset = offset
 	j.entryarray = h
+	j.entryarray_items = items
 
 	return nil
 }
 
-func (j *SdjournalReader) _next_entry_offset() (uint64, error) {
-	compact := (j.header.incompatible_flags & HEADER_INCOMPATIBLE_COMPACT) != 0
-
-	realsize := j.entryarray.object.size - ENTRY_ARRAY_OBJECT_SIZE
+/*
+ * Size of the entry offsets in entry arrays, and of the data offsets in
+ * entry objects below. Compact files store them as 32 bit offsets, the
+ * regular entry items also carry the hash of the data object.
+ *
+ * Code walking either kind of array must go through these rather than
+ * assume 64 bit offsets.
+ */
+func (j *SdjournalReader) _entryArrayItemSize() uint64 {
+	if j.IsCompact() {
+		return 32 / 8
+	}
+	return 64 / 8
+}
 
-	var item_size uint64
-	if compact {
-		item_size = 32 / 8
-	} else {
-		item_size = 64 / 8
+func (j *SdjournalReader) _dataArrayItemSize() uint64 {
+	if j.IsCompact() {
+		return 32 / 8
 	}
+	return (64 + 64) / 8
+}
 
-	array_size := realsize / item_size
+// Number of item slots in the array, trailing slots may still be unused (0)
+func (j *SdjournalReader) _entryArrayCapacity(h *EntryArrayObject) uint64 {
+	realsize := h.object.size - ENTRY_ARRAY_OBJECT_SIZE
 
-	if j.array_iterator < array_size {
-		slice := j.data[j.entry_array_offset+ENTRY_ARRAY_OBJECT_SIZE+(item_size*j.array_iterator) : j.entry_array_offset+ENTRY_ARRAY_OBJECT_SIZE+(item_size*j.array_iterator)+item_size]
+	return realsize / j._entryArrayItemSize()
+}
 
-		var entry_offset uint64
+func (j *SdjournalReader) _entryArrayItem(items []byte, i uint64) uint64 {
+	item_size := j._entryArrayItemSize()
+	slice := items[item_size*i : item_size*i+item_size]
 
-		if compact {
-			entry_offset = uint64(binary.LittleEndian.Uint32(slice))
-		} else {
-			entry_offset = binary.LittleEndian.Uint64(slice)
+	if item_size == 4 {
+		return uint64(binary.LittleEndian.Uint32(slice))
+	}
+	return binary.LittleEndian.Uint64(slice)
+}
+
+func (j *SdjournalReader) _next_entry_offset() (uint64, error) {
+	if j.entryarray == nil {
+		if j.header.entry_array_offset == 0 {
+			// No entries written yet
+			return 0, nil
 		}
+		err := j._loadEntryArrayObject(j.header.entry_array_offset)
+		if err != nil {
+			return 0, err
+		}
+	}
 
-		j.array_iterator++
-		return entry_offset, nil
-	} else {
-		if j.entryarray.next_entry_array_offset == 0 {
-			return 0, fmt.Errorf("No more items")
+	for j.array_iterator >= j._entryArrayCapacity(j.entryarray) {
+		next, err := _nextEntryArray(j.entry_array_offset, j.entryarray)
+		if err != nil {
+			return 0, err
+		}
+		if next == 0 {
+			// No more items
+			return 0, nil
 		}
-		err := j._loadEntryArrayObject(j.entryarray.next_entry_array_offset)
+		err = j._loadEntryArrayObject(next)
 		if err != nil {
 			return 0, err
 		}
-		return j._next_entry_offset()
 	}
 
-	return 0, fmt.Errorf("Unreacheable")
+	entry_offset := j._entryArrayItem(j.entryarray_items, j.array_iterator)
+	if entry_offset == 0 {
+		// Unused slot, stay on it in case the file is still written to
+		return 0, nil
+	}
+
+	j.array_iterator++
+	return entry_offset, nil
+}
+
+/*
+ * Calls fn with the offset of every entry, following the entry array
+ * chain from the start of the file.
+ *
+ * This does not touch the iteration state used by Next().
+ */
+func (j *SdjournalReader) _walkEntryArrays(fn func(entry_offset uint64) error) error {
+	array_offset := j.header.entry_array_offset
+
+	for array_offset != 0 {
+		h, items, err := j._entryArrayAt(array_offset)
+		if err != nil {
+			return err
+		}
+
+		array_size := j._entryArrayCapacity(h)
+		for i := uint64(0); i < array_size; i++ {
+			entry_offset := j._entryArrayItem(items, i)
+			if entry_offset == 0 {
+				// Unused slots at the end of the last array
+				return nil
+			}
+			err = fn(entry_offset)
+			if err != nil {
+				return err
+			}
+		}
+		array_offset, err = _nextEntryArray(array_offset, h)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type EntryObject struct {
@@ -195,43 +433,55 @@ type EntryObject struct {
 	xor_hash  uint64
 }
 
-func (j *SdjournalReader) _loadDataOffsetsFromEntry(offset uint64) ([]uint64, error) {
+func (j *SdjournalReader) _loadEntryObject(offset uint64) (*EntryObject, error) {
 	if (offset & 7) != 0 {
 		return nil, fmt.Errorf("Unaligned offset")
 	}
 
-	if uint64(len(j.data))-offset < ENTRY_OBJECT_SIZE {
-		return nil, fmt.Errorf("EOF")
+	buf, err := j._slice(offset, ENTRY_OBJECT_SIZE)
+	if err != nil {
+		return nil, err
 	}
 
-	h := (*EntryObject)(unsafe.Pointer(&j.data[offset]))
+	h := decode_entry_object(buf)
 
 	if h.object.type_ != OBJECT_ENTRY {
 		return nil, fmt.Errorf("Unexpected object encountered at %d", offset)
 	}
 
-	compact := (j.header.incompatible_flags & HEADER_INCOMPATIBLE_COMPACT) != 0
+	err = j._checkObjectSize(offset, &h.object, ENTRY_OBJECT_SIZE)
+	if err != nil {
+		return nil, err
+	}
 
-	realsize := h.object.size - ENTRY_OBJECT_SIZE
+	return h, nil
+}
 
-	var item_size uint64
-	if compact {
-		item_size = 4
-	} else {
-		item_size = 16
+func (j *SdjournalReader) _loadDataOffsetsFromEntry(offset uint64) ([]uint64, error) {
+	h, err := j._loadEntryObject(offset)
+	if err != nil {
+		return nil, err
 	}
 
+	realsize := h.object.size - ENTRY_OBJECT_SIZE
+
+	item_size := j._dataArrayItemSize()
 	array_size := realsize / item_size
 
+	items, err := j._slice(offset+ENTRY_OBJECT_SIZE, array_size*item_size)
+	if err != nil {
+		return nil, err
+	}
+
 	r := make([]uint64, array_size)
 
 	for i := uint64(0); i < array_size; i++ {
 
-		slice := j.data[offset+ENTRY_OBJECT_SIZE+(item_size*i) : offset+ENTRY_OBJECT_SIZE+(item_size*i)+item_size]
+		slice := items[item_size*i : item_size*i+item_size]
 
 		var data_offset uint64
 
-		if compact {
+		if item_size == 4 {
 			data_offset = uint64(binary.LittleEndian.Uint32(slice))
 		} else {
 			data_offset = binary.LittleEndian.Uint64(slice[0:8])
@@ -251,150 +501,1499 @@ type DataObject struct {
 	n_entries          uint64
 }
 
-func (j *SdjournalReader) _loadData(offset uint64) ([]byte, error) {
+/*
+ * In compact files the data object also records where its entry array
+ * chain ends, so that appending doesn't need to walk the chain. These
+ * fields sit between the common fields and the payload.
+ */
+type CompactDataObject struct {
+	DataObject
+	tail_entry_array_offset    uint32
+	tail_entry_array_n_entries uint32
+}
+
+/*
+ * Returns the data object at the given offset along with its payload,
+ * which is still compressed if the object flags say so.
+ */
+func (j *SdjournalReader) _loadDataObject(offset uint64) (*DataObject, []byte, error) {
 	if (offset & 7) != 0 {
-		return nil, fmt.Errorf("Unaligned offset")
+		return nil, nil, fmt.Errorf("Unaligned offset")
 	}
 
-	if uint64(len(j.data))-offset < DATA_OBJECT_SIZE {
-		return nil, fmt.Errorf("EOF")
+	buf, err := j._slice(offset, DATA_OBJECT_SIZE)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	h := (*DataObject)(unsafe.Pointer(&j.data[offset]))
+	h := decode_data_object(buf)
 
 	if h.object.type_ != OBJECT_DATA {
-		return nil, fmt.Errorf("Unexpected object encountered at %d", offset)
+		return nil, nil, fmt.Errorf("Unexpected object encountered at %d", offset)
+	}
+
+	// The payload follows the compact tail fields when present
+	header_size := uint64(DATA_OBJECT_SIZE)
+	if j.IsCompact() {
+		header_size = COMPACT_DATA_OBJECT_SIZE
 	}
 
-	compact := (j.header.incompatible_flags & HEADER_INCOMPATIBLE_COMPACT) != 0
+	err = j._checkObjectSize(offset, &h.object, header_size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := j._slice(offset+header_size, h.object.size-header_size)
+	if err != nil {
+		return nil, nil, err
+	}
+	j.stats.DataObjectsLoaded++
+
+	return h, payload, nil
+}
+
+func (j *SdjournalReader) _loadData(offset uint64) ([]byte, error) {
+	return j._loadDataTo(offset, nil)
+}
+
+/*
+ * Like _loadData() but decompresses into *scratch when given, growing it
+ * as needed, so that a buffer can be reused from one object to the
+ * next. Uncompressed payloads are still returned in place.
+ *
+ * With the data cache enabled, compressed payloads are decompressed into
+ * buffers of their own that the cache keeps, scratch is not used.
+ */
+func (j *SdjournalReader) _loadDataTo(offset uint64, scratch *[]byte) ([]byte, error) {
+	h, payload, err := j._loadDataObject(offset)
+	if err != nil {
+		return nil, err
+	}
 
-	skip := uint64(0)
-	if compact {
-		// NOTE: Ignoring the maybe fields for simplicity
-		skip = 8
+	if j.data_cache != nil && h.object.flags&_OBJECT_COMPRESSED_MASK != 0 {
+		buf, ok := j.data_cache.get(offset)
+		if ok {
+			j.stats.CacheHits++
+			return buf, nil
+		}
+		scratch = nil
 	}
 
-	realsize := h.object.size - DATA_OBJECT_SIZE - skip
+	var dst []byte
+	if scratch != nil {
+		dst = (*scratch)[:0]
+	}
 
-	payload := j.data[offset+DATA_OBJECT_SIZE+skip : offset+DATA_OBJECT_SIZE+skip+realsize]
+	buf := payload
 
 	if h.object.flags&OBJECT_COMPRESSED_XZ != 0 {
-		return nil, fmt.Errorf("XZ decompression not implemented")
+		return nil, fmt.Errorf("Data object at %d is XZ compressed, which this reader doesn't support, journalctl can read it", offset)
 	} else if h.object.flags&OBJECT_COMPRESSED_LZ4 != 0 {
-		return nil, fmt.Errorf("LZ4 decompression not implemented")
+		if (j.header.incompatible_flags & HEADER_INCOMPATIBLE_COMPRESSED_LZ4) == 0 {
+			return nil, fmt.Errorf("LZ4 compressed object at %d but the file doesn't declare LZ4 compression", offset)
+		}
+		buf, err = lz4_decompress(payload, dst, j.max_decompressed_size)
+		if err != nil {
+			return nil, fmt.Errorf("Data object at %d: %w", offset, err)
+		}
 	} else if h.object.flags&OBJECT_COMPRESSED_ZSTD != 0 {
-		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		if j.zstd_decoder == nil {
+			return nil, fmt.Errorf("ZSTD compressed object at %d but the file doesn't declare ZSTD compression", offset)
+		}
+		buf, err = j.zstd_decoder.DecodeAll(payload, dst)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Data object at %d: %w", offset, err)
 		}
-		return decoder.DecodeAll(payload, nil)
+	} else {
+		return payload, nil
 	}
 
-	return payload, nil
+	j.stats.ObjectsDecompressed++
+	j.stats.BytesCompressed += uint64(len(payload))
+	j.stats.BytesDecompressed += uint64(len(buf))
+
+	if j.data_cache != nil {
+		j.data_cache.put(offset, buf)
+	}
+	if scratch != nil {
+		*scratch = buf
+	}
+	return buf, nil
 }
 
-type SdjournalReader struct {
-	fd   *os.File
-	data mmap.MMap
+/*
+ * Returns the field name of the data object at the given offset.
+ *
+ * For uncompressed objects the name is read in place, without touching
+ * the value.
+ */
+func (j *SdjournalReader) _loadDataFieldName(offset uint64) ([]byte, error) {
+	h, payload, err := j._loadDataObject(offset)
+	if err != nil {
+		return nil, err
+	}
 
-	header *Header
+	if h.object.flags&_OBJECT_COMPRESSED_MASK != 0 {
+		payload, err = j._loadData(offset)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	entryarray         *EntryArrayObject
-	entry_array_offset uint64
-	array_iterator     uint64
+	i := bytes.IndexByte(payload, '=')
+	if i < 0 {
+		return nil, fmt.Errorf("Data object at %d has no field separator", offset)
+	}
+	return payload[:i], nil
+}
 
-	// Prevent reusing the object and doing anything before opening
-	opened bool
-	closed bool
+type FieldObject struct {
+	object           ObjectHeader
+	hash             uint64
+	next_hash_offset uint64
+	head_data_offset uint64
 }
 
-func (j *SdjournalReader) Open(journalfile string) error {
-	if j.opened {
-		return fmt.Errorf("This object has been opened already")
+// Returns the field object at the given offset along with the field name
+func (j *SdjournalReader) _loadFieldObject(offset uint64) (*FieldObject, []byte, error) {
+	if (offset & 7) != 0 {
+		return nil, nil, fmt.Errorf("Unaligned offset")
 	}
-	if j.closed {
-		return fmt.Errorf("This object has been closed already")
+
+	buf, err := j._slice(offset, FIELD_OBJECT_SIZE)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	j.opened = true
+	h := decode_field_object(buf)
 
-	fd, err := os.OpenFile(journalfile, os.O_RDONLY, 0)
-	if err != nil {
-		return err
+	if h.object.type_ != OBJECT_FIELD {
+		return nil, nil, fmt.Errorf("Unexpected object encountered at %d", offset)
 	}
-	j.fd = fd
 
-	data, err := mmap.Map(fd, mmap.RDONLY, 0)
+	err = j._checkObjectSize(offset, &h.object, FIELD_OBJECT_SIZE)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	j.data = data
 
-	if len(data) < HEADER_SIZE {
-		return fmt.Errorf("File is too small to read the header")
+	name, err := j._slice(offset+FIELD_OBJECT_SIZE, h.object.size-FIELD_OBJECT_SIZE)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	h := (*Header)(unsafe.Pointer(&data[0]))
-	if unsafe.Sizeof(*h) != HEADER_SIZE {
-		//NOTE There's no assertions in go, so we do it at runtime instead of compile time
-		return fmt.Errorf("Unsupported architecture")
+	return h, name, nil
+}
+
+/*
+ * Returns the offset of the first object in the hash table bucket for
+ * the given hash, 0 if the bucket or the table is empty.
+ */
+func (j *SdjournalReader) _hashBucketHead(name string, table_offset, table_size, hash uint64) (uint64, error) {
+	n_buckets := table_size / HASH_ITEM_SIZE
+	if n_buckets == 0 {
+		return 0, nil
+	}
+	if table_offset > j.size || j.size-table_offset < table_size {
+		return 0, fmt.Errorf("%s hash table is out of bounds", name)
 	}
 
-	if string(h.signature[:]) != "LPKSHHRH" {
-		return fmt.Errorf("Not a journal file")
+	bucket := table_offset + (hash%n_buckets)*HASH_ITEM_SIZE
+
+	// head_hash_offset is the first member of the HashItem
+	item, err := j._slice(bucket, 8)
+	if err != nil {
+		return 0, err
 	}
+	return binary.LittleEndian.Uint64(item), nil
+}
 
-	j.header = h
+/*
+ * Finds the field object for the given field name by walking the
+ * matching bucket chain of the field hash table.
+ *
+ * Returns the offset of the object and whether it was found.
+ */
+func (j *SdjournalReader) lookupField(field []byte) (uint64, bool, error) {
+	hash := j.hashPayload(field)
 
-	// Populate the initial array object
-	err = j._loadEntryArrayObject(h.entry_array_offset)
+	offset, err := j._hashBucketHead("Field", j.header.field_hash_table_offset, j.header.field_hash_table_size, hash)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
 
-	return nil
+	for offset != 0 {
+		h, name, err := j._loadFieldObject(offset)
+		if err != nil {
+			return 0, false, err
+		}
+		if h.hash == hash && bytes.Equal(name, field) {
+			return offset, true, nil
+		}
+		if h.next_hash_offset != 0 && h.next_hash_offset <= offset {
+			return 0, false, fmt.Errorf("Field object at %d links back to %d in its hash chain", offset, h.next_hash_offset)
+		}
+		offset = h.next_hash_offset
+	}
+
+	return 0, false, nil
 }
 
-func (j *SdjournalReader) Close() error {
-	if !j.opened {
-		return fmt.Errorf("This object hasn't been opened")
+/*
+ * A Forward Secure Sealing tag. It seals all objects before it with an
+ * HMAC keyed by the sealing key of the epoch.
+ */
+type TagObject struct {
+	object ObjectHeader
+	Seqnum uint64
+	Epoch  uint64
+	Tag    [TAG_LENGTH]byte
+}
+
+func (j *SdjournalReader) _loadTagObject(offset uint64) (*TagObject, error) {
+	if (offset & 7) != 0 {
+		return nil, fmt.Errorf("Unaligned offset")
 	}
-	if j.closed {
-		return fmt.Errorf("This object has been closed already")
+
+	buf, err := j._slice(offset, TAG_OBJECT_SIZE)
+	if err != nil {
+		return nil, err
 	}
 
-	j.closed = true
-	j.opened = false
+	h := decode_tag_object(buf)
 
-	err := j.data.Unmap()
-	if err != nil {
-		return err
+	if h.object.type_ != OBJECT_TAG {
+		return nil, fmt.Errorf("Unexpected object encountered at %d", offset)
 	}
-	j.fd.Close()
 
-	return nil
-}
+	err = j._checkObjectSize(offset, &h.object, TAG_OBJECT_SIZE)
+	if err != nil {
+		return nil, err
+	}
 
-type journalSorter struct {
-	filename          string
-	seqnum_id         [16]byte
-	head_entry_seqnum uint64
+	return h, nil
 }
 
 /*
- * Given a list of journal files, it sorts them in chronological
- * order.
+ * Finds the data object holding exactly the given payload ("FIELD=value")
+ * by walking the matching bucket chain of the data hash table.
  *
- * Files that cannot be opened as journald files are skipped.
- **/
-func SortJournalFiles(journalfiles []string) []string {
-
-	var files []journalSorter
+ * Objects are appended to the chains as they are written, so the chain
+ * offsets must grow. A chain linking backwards is reported as an error
+ * instead of being followed in circles.
+ *
+ * Returns the offset of the object and whether it was found.
+ */
+func (j *SdjournalReader) lookupData(payload []byte) (uint64, bool, error) {
+	hash := j.hashPayload(payload)
+
+	offset, err := j._hashBucketHead("Data", j.header.data_hash_table_offset, j.header.data_hash_table_size, hash)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for offset != 0 {
+		h, _, err := j._loadDataObject(offset)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if h.hash == hash {
+			buf, err := j._loadData(offset)
+			if err != nil {
+				return 0, false, err
+			}
+			if bytes.Equal(buf, payload) {
+				return offset, true, nil
+			}
+		}
+		if h.next_hash_offset != 0 && h.next_hash_offset <= offset {
+			return 0, false, fmt.Errorf("Data object at %d links back to %d in its hash chain", offset, h.next_hash_offset)
+		}
+		offset = h.next_hash_offset
+	}
+
+	return 0, false, nil
+}
+
+/*
+ * Reads a single journal file.
+ *
+ * The mapped file is reference counted: the reader that opened it holds
+ * one reference and so does every reader sharing the mapping with it,
+ * such as clones. Close() releases the reader's reference and the file
+ * is unmapped and closed once no reader references it anymore, so the
+ * readers can be closed in any order. Detach() releases the reference
+ * without ever unmapping, for callers that keep the mapping alive
+ * through another reader.
+ *
+ * Returned entries are copies and stay valid after that. The slices
+ * NextZeroCopy() passes and the values NextField() returns may point
+ * into the file, they must not be used once the mapping is released.
+ */
+type SdjournalReader struct {
+	mapping *sharedMapping
+	data    mmap.MMap
+
+	// Set instead of the mapping when reading through OpenReaderAt
+	ra io.ReaderAt
+
+	// The file passed to Open(), for Follow()
+	path string
+
+	// Size of the file, mapped or not
+	size uint64
+
+	header *Header
+
+	// Shared by all decompressions, created if the file uses ZSTD
+	zstd_decoder *zstd.Decoder
+
+	entryarray         *EntryArrayObject
+	entryarray_items   []byte
+	entry_array_offset uint64
+	array_iterator     uint64
+
+	// The entry most recently returned, for Cursor()
+	last_entry_offset uint64
+
+	// The next entry, when looked up ahead by Peek()
+	peeked *peekedEntry
+
+	// Values that returned entries must have, by field
+	matches map[string][]string
+
+	// Earlier groups of matches, closed by AddDisjunction()
+	disjunctions []map[string][]string
+
+	// The data objects of the groups of matches, see _matchTerms()
+	match_terms [][][]uint64
+
+	// When set, entries less important than this are skipped
+	max_priority     int
+	has_max_priority bool
+
+	// Fields that must not be present in returned entries
+	match_absent map[string]bool
+
+	// When set, only these fields are returned
+	field_filter map[string]bool
+
+	// When set, only entries of this boot are returned
+	boot_filter     [16]byte
+	has_boot_filter bool
+
+	// Realtime range of the entries returned, see OpenWindow()
+	window_start uint64
+	window_end   uint64
+	has_window   bool
+
+	// Unreadable fields are skipped and collected instead of failing
+	lenient bool
+	errors  []error
+
+	// Problems found by Open() that don't prevent reading the file
+	warnings []string
+
+	// Add the synthetic fields to the maps returned
+	include_meta bool
+
+	// How repeated fields end up in the maps returned
+	duplicate_policy DuplicateFieldPolicy
+
+	// Fail on field names journald wouldn't accept
+	strict_field_names bool
+
+	// Check the xor_hash of entries against their data objects
+	verify_xor_hash bool
+
+	// Open files with incompatible flags this reader doesn't know
+	allow_unknown_flags bool
+
+	// The file is being written to, see OpenOnline()
+	online bool
+
+	// Largest size a data object may decompress to, 0 for no limit
+	max_decompressed_size uint64
+
+	// Reused for decompressing the fields of entries
+	scratch []byte
+
+	// Decompressed payloads by offset, nil when disabled
+	data_cache *dataCache
+
+	// Shared strings for field names and values, nil when disabled
+	interner *stringInterner
+
+	// Counters for Stats()
+	stats ReaderStats
+
+	// Prevent reusing the object and doing anything before opening
+	opened bool
+	closed bool
+}
+
+/*
+ * Files with incompatible flags this reader doesn't know are refused by
+ * Open(), as they were written in a format it may misread. Allowing them
+ * reads such files anyway, at the caller's risk. Must be called before
+ * Open().
+ */
+func (j *SdjournalReader) AllowUnknownFlags(allow bool) {
+	j.allow_unknown_flags = allow
+}
+
+/*
+ * Limits the size compressed data objects may decompress to, so that a
+ * crafted file can't make the reader allocate huge buffers. Fields above
+ * the limit fail to read, or are skipped in lenient mode. 0, the
+ * default, means no limit. Must be called before Open().
+ *
+ * For files compressed as a whole, like a .journal.zst, the limit
+ * applies to the decompressed file.
+ */
+func (j *SdjournalReader) SetMaxDecompressedSize(n uint64) {
+	j.max_decompressed_size = n
+}
+
+func (j *SdjournalReader) Open(journalfile string) error {
+	if j.opened {
+		return fmt.Errorf("This object has been opened already")
+	}
+	if j.closed {
+		return fmt.Errorf("This object has been closed already")
+	}
+
+	j.opened = true
+	j.path = journalfile
+
+	fd, err := os.OpenFile(journalfile, os.O_RDONLY, 0)
+	if err != nil {
+		j.Close()
+		return err
+	}
+
+	return j._openMapped(fd, false)
+}
+
+/*
+ * Maps fd and reads the header. A borrowed fd belongs to the caller and
+ * is left open, also when this fails.
+ */
+func (j *SdjournalReader) _openMapped(fd *os.File, borrowed bool) error {
+	data, err := mmap.Map(fd, mmap.RDONLY, 0)
+	if err != nil {
+		if !borrowed {
+			fd.Close()
+		}
+		j.Close()
+		return err
+	}
+	j.mapping = newSharedMapping(fd, data)
+	j.mapping.borrowed = borrowed
+	j.data = data
+	j.size = uint64(len(data))
+
+	if bytes.HasPrefix(data, zstd_file_magic) {
+		err = j._decompressFile()
+	}
+	if err == nil {
+		err = j._init()
+	}
+	if err != nil {
+		// Unmaps and closes the file, the object can't be used anymore
+		j.Close()
+		return err
+	}
+	return nil
+}
+
+/*
+ * Opens a journal from a file the caller already holds, e.g. after
+ * checking its inode, without opening it again by path.
+ *
+ * The file is mapped like Open() does. The reader does not take
+ * ownership of f, Close() unmaps it but leaves f open, the caller closes
+ * it once the reader and its clones are closed. Follow() still opens the
+ * next file by the name of f.
+ */
+func OpenFile(f *os.File) (*SdjournalReader, error) {
+	j := &SdjournalReader{}
+	j.opened = true
+	j.path = f.Name()
+
+	err := j._openMapped(f, true)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+/*
+ * Replaces the mapping of a journal file that was compressed as a whole,
+ * e.g. a .journal.zst from an archive, with its decompressed contents.
+ *
+ * The whole file is held in memory, so this is only suitable for files
+ * that fit into it. Such a reader can't be followed or detached.
+ *
+ * A journal file is its header and arena, so the output is capped at the
+ * size the decompressed header gives for them, and at the limit of
+ * SetMaxDecompressedSize() if smaller. Output beyond is an error rather
+ * than being buffered.
+ */
+func (j *SdjournalReader) _decompressFile() error {
+	decoder, err := zstd.NewReader(bytes.NewReader(j.data), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	header_end := unsafe.Offsetof(j.header.arena_size) + 8
+	data := make([]byte, header_end)
+	_, err = io.ReadFull(decoder, data)
+	if err != nil {
+		return fmt.Errorf("Decompressing the journal file header: %w", err)
+	}
+
+	header_size := binary.LittleEndian.Uint64(data[unsafe.Offsetof(j.header.header_size):])
+	arena_size := binary.LittleEndian.Uint64(data[unsafe.Offsetof(j.header.arena_size):])
+	limit := header_size + arena_size
+	if limit < header_size {
+		return fmt.Errorf("Header and arena size of the journal file overflow")
+	}
+	if j.max_decompressed_size != 0 && limit > j.max_decompressed_size {
+		limit = j.max_decompressed_size
+	}
+	if limit < uint64(header_end) {
+		return fmt.Errorf("Decompressed journal file exceeds %d bytes", limit)
+	}
+
+	// The sizes aren't trusted for allocating, the buffer grows as read
+	buf := bytes.NewBuffer(data)
+	_, err = buf.ReadFrom(io.LimitReader(decoder, int64(min(limit-uint64(header_end)+1, math.MaxInt64))))
+	if err != nil {
+		return fmt.Errorf("Decompressing the journal file: %w", err)
+	}
+	if uint64(buf.Len()) > limit {
+		return fmt.Errorf("Decompressed journal file exceeds %d bytes", limit)
+	}
+
+	err = j.mapping.release()
+	j.mapping = nil
+	j.data = buf.Bytes()
+	j.size = uint64(len(j.data))
+	return err
+}
+
+/*
+ * Opens a journal read through an io.ReaderAt rather than a mapped file,
+ * for platforms or filesystems where mmap is not available.
+ *
+ * Every object access turns into a ReadAt call. The reader does not take
+ * ownership of r, Close() leaves it open.
+ */
+func OpenReaderAt(r io.ReaderAt, size int64) (*SdjournalReader, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("Invalid size %d", size)
+	}
+
+	j := &SdjournalReader{}
+	j.opened = true
+	j.ra = r
+	j.size = uint64(size)
+
+	err := j._init()
+	if err != nil {
+		j.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+/*
+ * Returns n bytes of the file starting at offset.
+ *
+ * For a mapped file this is a slice of the mapping, otherwise the bytes
+ * are read from the io.ReaderAt into a new buffer.
+ */
+func (j *SdjournalReader) _slice(offset uint64, n uint64) ([]byte, error) {
+	if offset > j.size || j.size-offset < n {
+		return nil, fmt.Errorf("EOF")
+	}
+
+	if j.ra == nil {
+		return j.data[offset : offset+n], nil
+	}
+
+	buf := make([]byte, n)
+	read, err := j.ra.ReadAt(buf, int64(offset))
+	if uint64(read) < n {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Creates the decoder for ZSTD compressed data objects
+func (j *SdjournalReader) _newZstdDecoder() (*zstd.Decoder, error) {
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if j.max_decompressed_size != 0 {
+		opts = append(opts, zstd.WithDecoderMaxMemory(j.max_decompressed_size))
+	}
+	return zstd.NewReader(nil, opts...)
+}
+
+// Reads and validates the header once the data source is set up
+func (j *SdjournalReader) _init() error {
+	err := j._loadHeader()
+	if err != nil {
+		return err
+	}
+	h := j.header
+
+	err = j._checkHeaderSize()
+	if err != nil {
+		if !j.lenient {
+			return err
+		}
+		// RecoverEntries() doesn't need the header to find the entries
+		j.warnings = append(j.warnings, err.Error())
+	}
+
+	unknown := h.incompatible_flags &^ _HEADER_INCOMPATIBLE_SUPPORTED
+	if unknown != 0 && !j.allow_unknown_flags {
+		return fmt.Errorf("Unknown incompatible flags 0x%x, the file may use a format this reader can't parse", unknown)
+	}
+
+	if (h.incompatible_flags & HEADER_INCOMPATIBLE_COMPRESSED_XZ) != 0 {
+		j.warnings = append(j.warnings, "The file may contain XZ compressed fields, reading them will fail as XZ is not supported")
+	}
+
+	if (h.incompatible_flags & HEADER_INCOMPATIBLE_COMPRESSED_ZSTD) != 0 {
+		j.zstd_decoder, err = j._newZstdDecoder()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Populate the initial array object, unless the file has no entries yet
+	if h.entry_array_offset != 0 {
+		err = j._loadEntryArrayObject(h.entry_array_offset)
+		if err != nil && !j.lenient {
+			return err
+		}
+		// Otherwise Next() tries again and fails, RecoverEntries() may
+		// still find the entries
+	}
+
+	return nil
+}
+
+/*
+ * Checks the header_size the file declares. Newer versions have a larger
+ * header than HEADER_SIZE, objects start after the declared one, so the
+ * offsets of the header must point past it.
+ */
+func (j *SdjournalReader) _checkHeaderSize() error {
+	h := j.header
+
+	if h.header_size < HEADER_SIZE || h.header_size&7 != 0 {
+		return fmt.Errorf("Invalid header size %d", h.header_size)
+	}
+	if h.header_size > j.size {
+		return fmt.Errorf("File is too small for its %d byte header", h.header_size)
+	}
+	for _, offset := range []uint64{h.entry_array_offset, h.tail_object_offset, h.data_hash_table_offset, h.field_hash_table_offset} {
+		if offset != 0 && offset < h.header_size {
+			return fmt.Errorf("Object offset %d in the header points into the %d byte header", offset, h.header_size)
+		}
+	}
+	return nil
+}
+
+// Points j.header at the header of the current data source
+func (j *SdjournalReader) _loadHeader() error {
+	if j.size < HEADER_SIZE {
+		return fmt.Errorf("File is too small to read the header")
+	}
+
+	// The header struct includes the fields of newer versions, read as
+	// much of it as the file has. _headerHas() guards the access to them.
+	n := uint64(unsafe.Sizeof(Header{}))
+	if n > j.size {
+		n = j.size
+	}
+	data, err := j._slice(0, n)
+	if err != nil {
+		return err
+	}
+
+	// The struct is cast onto the data, it must not reach past it
+	if n < uint64(unsafe.Sizeof(Header{})) {
+		buf := make([]byte, unsafe.Sizeof(Header{}))
+		copy(buf, data)
+		data = buf
+	}
+
+	h := decode_header(data)
+
+	if string(h.signature[:]) != "LPKSHHRH" {
+		return fmt.Errorf("Not a journal file")
+	}
+
+	j.header = h
+
+	return nil
+}
+
+/*
+ * Releases the file. Closing a reader that is already closed, or was
+ * never opened, does nothing, so Close() is safe to defer right after
+ * declaring the reader.
+ */
+func (j *SdjournalReader) Close() error {
+	if !j.opened || j.closed {
+		return nil
+	}
+
+	j.closed = true
+	j.opened = false
+
+	if j.zstd_decoder != nil {
+		j.zstd_decoder.Close()
+	}
+
+	if j.mapping == nil {
+		return nil
+	}
+	return j.mapping.release()
+}
+
+/*
+ * Gives up this reader's reference to the mapped file without unmapping
+ * it, leaving the reader closed.
+ *
+ * This fails if the reader holds the last reference, since the mapping
+ * could then never be released; use Close() in that case.
+ */
+func (j *SdjournalReader) Detach() error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+	if j.closed {
+		return fmt.Errorf("This object has been closed already")
+	}
+	if j.mapping == nil {
+		return fmt.Errorf("This object doesn't read from a mapped file")
+	}
+
+	err := j.mapping.detach()
+	if err != nil {
+		return err
+	}
+
+	if j.zstd_decoder != nil {
+		j.zstd_decoder.Close()
+	}
+
+	j.closed = true
+	j.opened = false
+
+	return nil
+}
+
+/*
+ * Moves the iterator back to the first entry, or the start of the window
+ * given to OpenWindow(), so the file can be read again without reopening
+ * it. Filters are kept.
+ */
+func (j *SdjournalReader) Reset() error {
+	if j.closed {
+		return fmt.Errorf("This object has been closed already")
+	}
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+
+	j.last_entry_offset = 0
+	j.peeked = nil
+
+	if j.header.entry_array_offset == 0 {
+		j._setPosition(0, nil, nil, 0)
+		return nil
+	}
+	if j.has_window {
+		return j._seekWindowStart()
+	}
+	return j._loadEntryArrayObject(j.header.entry_array_offset)
+}
+
+/*
+ * Returns an independent reader over the same file, positioned where
+ * this one is and with the same filters.
+ *
+ * The clone shares the mapped file but iterates on its own, so clones
+ * can be used from different goroutines to process parts of a large
+ * file in parallel. A single reader must still not be used concurrently.
+ *
+ * The clone must be closed separately. It holds its own reference to
+ * the mapping and stays valid after the parent's Close(); a clone of a
+ * reader from OpenReaderAt reads from the same io.ReaderAt.
+ */
+func (j *SdjournalReader) Clone() (*SdjournalReader, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	c := *j
+	c.matches = clone_matches(j.matches)
+	c.disjunctions = nil
+	for _, matches := range j.disjunctions {
+		c.disjunctions = append(c.disjunctions, clone_matches(matches))
+	}
+	c.match_absent = maps.Clone(j.match_absent)
+	c.errors = nil
+	c.field_filter = maps.Clone(j.field_filter)
+	c.scratch = nil
+	c.stats = ReaderStats{}
+	if j.peeked != nil {
+		// The clone is past the peeked entry too, without its work
+		p := *j.peeked
+		p.stats = ReaderStats{}
+		p.errors = nil
+		c.peeked = &p
+	}
+	// Only a reader owning its mapping can remap it
+	c.online = false
+	if j.data_cache != nil {
+		c.data_cache = newDataCache(j.data_cache.size)
+	}
+	if j.interner != nil {
+		c.interner = newStringInterner()
+	}
+
+	// Decoders are not shared, each reader decompresses on its own
+	if j.zstd_decoder != nil {
+		var err error
+		c.zstd_decoder, err = c._newZstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if j.mapping != nil {
+		j.mapping.acquire()
+	}
+
+	return &c, nil
+}
+
+/*
+ * Reports whether the header is large enough to contain a field ending
+ * at the given offset. Fields were appended to the header over time, so
+ * older files have a smaller header_size.
+ *
+ * Offsets come from unsafe.Offsetof, every header field is at its
+ * natural alignment so Go places it at its on-disk offset.
+ */
+func (j *SdjournalReader) _headerHas(field_end uintptr) bool {
+	return j.header.header_size >= uint64(field_end) && j.size >= uint64(field_end)
+}
+
+func (j *SdjournalReader) _checkHeaderField(name string, field_end uintptr) error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+	if !j._headerHas(field_end) {
+		return fmt.Errorf("Field %s not present in this version", name)
+	}
+	return nil
+}
+
+/*
+ * Returns the number of entries in the file, e.g. to size a progress
+ * bar before iterating.
+ */
+func (j *SdjournalReader) NumEntries() (uint64, error) {
+	if !j.opened {
+		return 0, fmt.Errorf("This object hasn't been opened")
+	}
+	return j.header.n_entries, nil
+}
+
+/*
+ * Returns the number of objects of any type in the file.
+ */
+func (j *SdjournalReader) NumObjects() (uint64, error) {
+	if !j.opened {
+		return 0, fmt.Errorf("This object hasn't been opened")
+	}
+	return j.header.n_objects, nil
+}
+
+/*
+ * Accessors for the header fields added after the initial format.
+ *
+ * They return an error when the file was written by a systemd version
+ * predating the field.
+ */
+
+func (j *SdjournalReader) NumData() (uint64, error) {
+	err := j._checkHeaderField("n_data", unsafe.Offsetof(j.header.n_data)+8)
+	if err != nil {
+		return 0, err
+	}
+	return j.header.n_data, nil
+}
+
+func (j *SdjournalReader) NumFields() (uint64, error) {
+	err := j._checkHeaderField("n_fields", unsafe.Offsetof(j.header.n_fields)+8)
+	if err != nil {
+		return 0, err
+	}
+	return j.header.n_fields, nil
+}
+
+func (j *SdjournalReader) NumTags() (uint64, error) {
+	err := j._checkHeaderField("n_tags", unsafe.Offsetof(j.header.n_tags)+8)
+	if err != nil {
+		return 0, err
+	}
+	return j.header.n_tags, nil
+}
+
+/*
+ * Returns the number of entry arrays in the file.
+ *
+ * Together with the number of entries this gives the average fan-out of
+ * the entry array chain, and thus how costly walking it is.
+ */
+func (j *SdjournalReader) NumEntryArrays() (uint64, error) {
+	err := j._checkHeaderField("n_entry_arrays", unsafe.Offsetof(j.header.n_entry_arrays)+8)
+	if err != nil {
+		return 0, err
+	}
+	return j.header.n_entry_arrays, nil
+}
+
+func (j *SdjournalReader) DataHashChainDepth() (uint64, error) {
+	err := j._checkHeaderField("data_hash_chain_depth", unsafe.Offsetof(j.header.data_hash_chain_depth)+8)
+	if err != nil {
+		return 0, err
+	}
+	return j.header.data_hash_chain_depth, nil
+}
+
+func (j *SdjournalReader) FieldHashChainDepth() (uint64, error) {
+	err := j._checkHeaderField("field_hash_chain_depth", unsafe.Offsetof(j.header.field_hash_chain_depth)+8)
+	if err != nil {
+		return 0, err
+	}
+	return j.header.field_hash_chain_depth, nil
+}
+
+/*
+ * Returns the reasons why journald would rotate the file because of its
+ * hash tables, none if they are fine: a hash chain longer than
+ * HASH_CHAIN_DEPTH_MAX, or a table at least 75% full. Lookups get slower
+ * in either case.
+ *
+ * Checks needing header fields the file predates are left out.
+ */
+func (j *SdjournalReader) HashTableHealth() ([]string, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	var r []string
+	h := j.header
+
+	if j._headerHas(unsafe.Offsetof(h.n_data)+8) && h.n_data*4 > h.data_hash_table_size/HASH_ITEM_SIZE*3 {
+		r = append(r, fmt.Sprintf("Data hash table with %d buckets holds %d items, at least 75%% full", h.data_hash_table_size/HASH_ITEM_SIZE, h.n_data))
+	}
+	if j._headerHas(unsafe.Offsetof(h.n_fields)+8) && h.n_fields*4 > h.field_hash_table_size/HASH_ITEM_SIZE*3 {
+		r = append(r, fmt.Sprintf("Field hash table with %d buckets holds %d items, at least 75%% full", h.field_hash_table_size/HASH_ITEM_SIZE, h.n_fields))
+	}
+	if j._headerHas(unsafe.Offsetof(h.data_hash_chain_depth)+8) && h.data_hash_chain_depth > HASH_CHAIN_DEPTH_MAX {
+		r = append(r, fmt.Sprintf("Data hash table has a chain of length %d", h.data_hash_chain_depth))
+	}
+	if j._headerHas(unsafe.Offsetof(h.field_hash_chain_depth)+8) && h.field_hash_chain_depth > HASH_CHAIN_DEPTH_MAX {
+		r = append(r, fmt.Sprintf("Field hash table has a chain of length %d", h.field_hash_chain_depth))
+	}
+	return r, nil
+}
+
+func (j *SdjournalReader) TailEntryArrayOffset() (uint64, error) {
+	err := j._checkHeaderField("tail_entry_array_offset", unsafe.Offsetof(j.header.tail_entry_array_offset)+4)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(j.header.tail_entry_array_offset), nil
+}
+
+func (j *SdjournalReader) TailEntryArrayNEntries() (uint64, error) {
+	err := j._checkHeaderField("tail_entry_array_n_entries", unsafe.Offsetof(j.header.tail_entry_array_n_entries)+4)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(j.header.tail_entry_array_n_entries), nil
+}
+
+func (j *SdjournalReader) TailEntryOffset() (uint64, error) {
+	err := j._checkHeaderField("tail_entry_offset", unsafe.Offsetof(j.header.tail_entry_offset)+8)
+	if err != nil {
+		return 0, err
+	}
+	return j.header.tail_entry_offset, nil
+}
+
+/*
+ * The 128-bit ids of the header. ID128 converts to [16]byte and prints
+ * as the 32 hex digits systemd uses.
+ */
+
+// The machine that wrote the file
+func (j *SdjournalReader) MachineID() (ID128, error) {
+	if !j.opened {
+		return ID128{}, fmt.Errorf("This object hasn't been opened")
+	}
+	return ID128(j.header.machine_id), nil
+}
+
+// Random id of the file, it changes on rotation
+func (j *SdjournalReader) FileID() (ID128, error) {
+	if !j.opened {
+		return ID128{}, fmt.Errorf("This object hasn't been opened")
+	}
+	return ID128(j.header.file_id), nil
+}
+
+// Identifies the seqnum series, shared by files rotated from each other
+func (j *SdjournalReader) SeqnumID() (ID128, error) {
+	if !j.opened {
+		return ID128{}, fmt.Errorf("This object hasn't been opened")
+	}
+	return ID128(j.header.seqnum_id), nil
+}
+
+// The boot of the last entry written to the file
+func (j *SdjournalReader) BootID() (ID128, error) {
+	if !j.opened {
+		return ID128{}, fmt.Errorf("This object hasn't been opened")
+	}
+	return ID128(j.header.tail_entry_boot_id), nil
+}
+
+/*
+ * Returns the boot of the last entry of the file, the zero id if it has
+ * none, e.g. to pick the files holding the current boot, see
+ * CurrentBootID().
+ *
+ * Before journald 254, which sets HEADER_COMPATIBLE_TAIL_ENTRY_BOOT_ID,
+ * the header's boot id is the one of the last writer, which may not have
+ * written any entry. The last entry is read for those files, found from
+ * the tail fields of the header when present, which is why this can
+ * fail. ID128 is a [16]byte, its String() is the form journalctl prints.
+ */
+func (j *SdjournalReader) TailBootID() (ID128, error) {
+	if !j.opened {
+		return ID128{}, fmt.Errorf("This object hasn't been opened")
+	}
+	if (j.header.compatible_flags & HEADER_COMPATIBLE_TAIL_ENTRY_BOOT_ID) != 0 {
+		return ID128(j.header.tail_entry_boot_id), nil
+	}
+
+	offset, err := j._tailEntry()
+	if err != nil || offset == 0 {
+		return ID128{}, err
+	}
+	h, err := j._loadEntryObject(offset)
+	if err != nil {
+		return ID128{}, err
+	}
+	return ID128(h.boot_id), nil
+}
+
+// Returns the offset of the last entry, 0 if there is none
+func (j *SdjournalReader) _tailEntry() (uint64, error) {
+	if j._headerHas(unsafe.Offsetof(j.header.tail_entry_offset)+8) && j.header.tail_entry_offset != 0 {
+		return j.header.tail_entry_offset, nil
+	}
+
+	_, _, items, used, ok := j._tailEntryArray()
+	if ok && used > 0 {
+		return j._entryArrayItem(items, used-1), nil
+	}
+
+	last := uint64(0)
+	err := j._walkEntryArrays(func(entry_offset uint64) error {
+		last = entry_offset
+		return nil
+	})
+	return last, err
+}
+
+/*
+ * Returns the boot id of the running system, to compare with the ones of
+ * the files.
+ */
+func CurrentBootID() (ID128, error) {
+	buf, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ID128{}, err
+	}
+	id, err := ParseID128(strings.TrimSpace(string(buf)))
+	return ID128(id), err
+}
+
+/*
+ * Returns the state of the file, one of the STATE_ constants. A reader
+ * that isn't open returns 0 like an offline file, IsClean() tells them
+ * apart.
+ */
+func (j *SdjournalReader) State() uint8 {
+	if !j.opened {
+		return 0
+	}
+	return j.header.state
+}
+
+/*
+ * Reports whether the file was closed properly, i.e. it is offline or
+ * archived. An online file is still being written to or its writer
+ * crashed, and its header counters and tail may be stale.
+ */
+func (j *SdjournalReader) IsClean() bool {
+	return j.opened && j.header.state != STATE_ONLINE
+}
+
+/*
+ * Reports whether the file is sealed with Forward Secure Sealing, in
+ * which case it contains tag objects that allow verifying it.
+ */
+func (j *SdjournalReader) IsSealed() bool {
+	return j.opened && (j.header.compatible_flags&HEADER_COMPATIBLE_SEALED) != 0
+}
+
+/*
+ * Reports whether the file uses the compact format of journald 252 and
+ * later, with 32 bit offsets in entries and entry arrays and data
+ * objects recording the tail of their entry array chain.
+ */
+func (j *SdjournalReader) IsCompact() bool {
+	return j.opened && (j.header.incompatible_flags&HEADER_INCOMPATIBLE_COMPACT) != 0
+}
+
+/*
+ * Returns the realtime timestamps of the first and last entry, in
+ * microseconds since the epoch, straight from the header.
+ *
+ * This is enough to tell whether a file can hold entries of a given time
+ * window without reading any of them. Both are 0 for an empty file.
+ */
+func (j *SdjournalReader) RealtimeRange() (head, tail uint64, err error) {
+	if !j.opened {
+		return 0, 0, fmt.Errorf("This object hasn't been opened")
+	}
+	return j.header.head_entry_realtime, j.header.tail_entry_realtime, nil
+}
+
+// Like RealtimeRange() for the seqnums of the first and last entry
+func (j *SdjournalReader) SeqnumRange() (head, tail uint64, err error) {
+	if !j.opened {
+		return 0, 0, fmt.Errorf("This object hasn't been opened")
+	}
+	return j.header.head_entry_seqnum, j.header.tail_entry_seqnum, nil
+}
+
+/*
+ * Reports whether any entry in the journal has the field set to the
+ * given value.
+ *
+ * This is answered from the data hash table alone, without looking at
+ * the entries, so it is a cheap way to find out which of many files
+ * are worth scanning.
+ */
+func (j *SdjournalReader) HasValue(field, value string) (bool, error) {
+	if !j.opened {
+		return false, fmt.Errorf("This object hasn't been opened")
+	}
+
+	offset, found, err := j.lookupData([]byte(field + "=" + value))
+	if err != nil || !found {
+		return false, err
+	}
+
+	h, _, err := j._loadDataObject(offset)
+	if err != nil {
+		return false, err
+	}
+	return h.n_entries > 0, nil
+}
+
+/*
+ * Returns the names of all fields used in the journal, sorted, like
+ * journalctl --fields.
+ *
+ * The names are read from the field hash table, no entries are looked
+ * at.
+ */
+func (j *SdjournalReader) ListFields() ([]string, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	table_offset := j.header.field_hash_table_offset
+	table_size := j.header.field_hash_table_size
+	if table_offset > j.size || j.size-table_offset < table_size {
+		return nil, fmt.Errorf("Field hash table is out of bounds")
+	}
+
+	var r []string
+
+	for bucket := uint64(0); bucket < table_size/HASH_ITEM_SIZE; bucket++ {
+		// head_hash_offset is the first member of the HashItem
+		item, err := j._slice(table_offset+bucket*HASH_ITEM_SIZE, 8)
+		if err != nil {
+			return nil, err
+		}
+
+		offset := binary.LittleEndian.Uint64(item)
+		for offset != 0 {
+			h, name, err := j._loadFieldObject(offset)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, string(name))
+			if h.next_hash_offset != 0 && h.next_hash_offset <= offset {
+				return nil, fmt.Errorf("Field object at %d links back to %d in its hash chain", offset, h.next_hash_offset)
+			}
+			offset = h.next_hash_offset
+		}
+	}
+
+	sort.Strings(r)
+	return r, nil
+}
+
+/*
+ * Returns all values the given field takes in the journal, sorted, like
+ * journalctl -F.
+ *
+ * The field object links every data object of the field, so only those
+ * are read, no entries are looked at. Each value appears once.
+ */
+func (j *SdjournalReader) QueryUnique(field string) ([]string, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	var r []string
+
+	err := j._walkFieldData(field, func(d *DataObject, value []byte) error {
+		r = append(r, string(value))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(r)
+	return r, nil
+}
+
+/*
+ * Returns how many entries have each value of the given field, e.g. the
+ * number of entries per _SYSTEMD_UNIT.
+ *
+ * The counts are the n_entries of the data objects, so like QueryUnique()
+ * no entries are read. Filters set on the reader are not applied. Being a
+ * map, the result has no order, sorting is left to the caller.
+ */
+func (j *SdjournalReader) CountByField(field string) (map[string]uint64, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	r := make(map[string]uint64)
+
+	err := j._walkFieldData(field, func(d *DataObject, value []byte) error {
+		r[string(value)] = d.n_entries
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+/*
+ * Calls fn with every data object of the given field and its value,
+ * following the chain that starts at the field object.
+ *
+ * New data objects are put at the head of the chain, so the offsets must
+ * shrink along it. A chain linking forwards is reported as an error
+ * instead of being followed in circles.
+ */
+func (j *SdjournalReader) _walkFieldData(field string, fn func(d *DataObject, value []byte) error) error {
+	field_offset, found, err := j.lookupField([]byte(field))
+	if err != nil || !found {
+		return err
+	}
+
+	h, _, err := j._loadFieldObject(field_offset)
+	if err != nil {
+		return err
+	}
+
+	prefix := []byte(field + "=")
+
+	offset := h.head_data_offset
+	for offset != 0 {
+		d, _, err := j._loadDataObject(offset)
+		if err != nil {
+			return err
+		}
+
+		buf, err := j._loadData(offset)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(buf, prefix) {
+			return fmt.Errorf("Data object at %d is linked from field %s but doesn't belong to it", offset, field)
+		}
+
+		err = fn(d, buf[len(prefix):])
+		if err != nil {
+			return err
+		}
+
+		if d.next_field_offset != 0 && d.next_field_offset >= offset {
+			return fmt.Errorf("Data object at %d links forward to %d in the chain of field %s", offset, d.next_field_offset, field)
+		}
+		offset = d.next_field_offset
+	}
+	return nil
+}
+
+/*
+ * Returns the tag objects of a sealed file, in file order.
+ *
+ * Tags are not linked from anywhere, so this walks every object in the
+ * file. The tags are not verified, that needs the verification key.
+ */
+func (j *SdjournalReader) Tags() ([]TagObject, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	var r []TagObject
+
+	err := j._walkObjects(func(offset uint64, h *ObjectHeader) error {
+		if h.type_ != OBJECT_TAG {
+			return nil
+		}
+		tag, err := j._loadTagObject(offset)
+		if err != nil {
+			return err
+		}
+		r = append(r, *tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+type EntryRef struct {
+	Offset   uint64
+	Seqnum   uint64
+	Realtime uint64
+}
+
+/*
+ * Returns the offset, seqnum and realtime of every entry in the file, in
+ * file order.
+ *
+ * This is a single forward pass over the entry arrays that only reads
+ * the entry headers, so it is suitable for building an external index
+ * that allows random access later on. It does not affect Next().
+ */
+func (j *SdjournalReader) BuildEntryIndex() ([]EntryRef, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	// n_entries is only a hint, don't trust it for the allocation
+	n := j.header.n_entries
+	if max := j.size / ENTRY_OBJECT_SIZE; n > max {
+		n = max
+	}
+	r := make([]EntryRef, 0, n)
+
+	err := j._walkEntryArrays(func(offset uint64) error {
+		h, err := j._loadEntryObject(offset)
+		if err != nil {
+			return err
+		}
+		r = append(r, EntryRef{offset, h.seqnum, h.realtime})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+/*
+ * Returns the entry object at the given offset, e.g. one from
+ * BuildEntryIndex(), like NextEntry() would. Filters are not applied and
+ * the iterator doesn't move.
+ */
+func (j *SdjournalReader) EntryAt(offset uint64) (*Entry, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	return j._readEntry(offset)
+}
+
+type journalSorter struct {
+	filename          string
+	seqnum_id         [16]byte
+	head_entry_seqnum uint64
+}
+
+/*
+ * Given a list of journal files, it sorts them in chronological
+ * order.
+ *
+ * Files that cannot be opened as journald files are skipped.
+ **/
+func SortJournalFiles(journalfiles []string) []string {
+	r, _ := SortJournalFilesStrict(journalfiles)
+	return r
+}
+
+/*
+ * Like SortJournalFiles() but also returns why each skipped file could
+ * not be opened, by file name, so that callers can report them.
+ */
+func SortJournalFilesStrict(journalfiles []string) ([]string, map[string]error) {
+
+	var files []journalSorter
+	failed := make(map[string]error)
 
 	for i := 0; i < len(journalfiles); i++ {
 		j := SdjournalReader{}
 		err := j.Open(journalfiles[i])
 		if err != nil {
+			failed[journalfiles[i]] = err
 			continue
 		}
 
@@ -412,21 +2011,236 @@ func SortJournalFiles(journalfiles []string) []string {
 		return files[i].head_entry_seqnum < files[j].head_entry_seqnum
 	})
 
-	var r []string
-	for i := 0; i < len(files); i++ {
-		r = append(r, files[i].filename)
+	var r []string
+	for i := 0; i < len(files); i++ {
+		r = append(r, files[i].filename)
+	}
+
+	return r, failed
+}
+
+func compare_seqnum_id(a [16]byte, b [16]byte) int {
+	for i := 0; i < 16; i++ {
+		if d := int(a[i]) - int(b[i]); d != 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+/*
+ * Only return entries that don't have the given field at all, e.g.
+ * entries without a _SYSTEMD_UNIT.
+ *
+ * Absence can't be looked up in the hash tables, so this always scans
+ * every entry. Only the field names are inspected, uncompressed values
+ * are never read.
+ */
+func (j *SdjournalReader) AddMatchAbsent(field string) error {
+	if field == "" || strings.Contains(field, "=") {
+		return fmt.Errorf("Invalid field name %q", field)
+	}
+	if j.match_absent == nil {
+		j.match_absent = make(map[string]bool)
+	}
+	j.match_absent[field] = true
+	j._filtersChanged()
+	return nil
+}
+
+/*
+ * Restrict the fields returned for each entry to the given ones. Can be
+ * called multiple times to add more fields.
+ *
+ * Uncompressed values of other fields are never copied. Compressed data
+ * objects still have to be decompressed to learn their field name, but
+ * unwanted ones are dropped right away.
+ *
+ * This does not affect which entries are returned.
+ */
+func (j *SdjournalReader) AddFieldFilter(fields ...string) {
+	if j.field_filter == nil {
+		j.field_filter = make(map[string]bool)
+	}
+	for _, field := range fields {
+		j.field_filter[field] = true
+	}
+	j._filtersChanged()
+}
+
+/*
+ * Only return entries logged during the given boot, like journalctl -b.
+ *
+ * The boot id is stored in the entry object itself, so no data objects
+ * are read to apply this filter.
+ */
+func (j *SdjournalReader) SetBootFilter(bootID [16]byte) {
+	j.boot_filter = bootID
+	j.has_boot_filter = true
+	j._filtersChanged()
+}
+
+/*
+ * Returns the distinct boot ids of the entries in the file, in order of
+ * first appearance.
+ *
+ * This scans the entry objects without reading their data and does not
+ * affect Next().
+ */
+func (j *SdjournalReader) ListBoots() ([][16]byte, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	var r [][16]byte
+	seen := make(map[[16]byte]bool)
+
+	err := j._walkEntryArrays(func(offset uint64) error {
+		h, err := j._loadEntryObject(offset)
+		if err != nil {
+			return err
+		}
+		if !seen[h.boot_id] {
+			seen[h.boot_id] = true
+			r = append(r, h.boot_id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (j *SdjournalReader) _entryMatches(offset uint64) (bool, error) {
+	if j._priorityPerEntry() {
+		ok, err := j._priorityMatches(offset)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	if j.has_boot_filter {
+		h, err := j._loadEntryObject(offset)
+		if err != nil {
+			return false, err
+		}
+		if h.boot_id != j.boot_filter {
+			return false, nil
+		}
+	}
+
+	if len(j.match_absent) == 0 {
+		return true, nil
+	}
+
+	offsetdata, err := j._loadDataOffsetsFromEntry(offset)
+	if err != nil {
+		return false, err
+	}
+
+	for i := 0; i < len(offsetdata); i++ {
+		name, err := j._loadDataFieldName(offsetdata[i])
+		if err != nil {
+			err = j._skipField(offset, err)
+			if err != nil {
+				return false, err
+			}
+			continue
+		}
+		if j.match_absent[string(name)] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Returns the offset of the next entry passing the filters, 0 at the end
+func (j *SdjournalReader) _next_matching_entry_offset(ctx context.Context) (uint64, error) {
+	if j.peeked != nil {
+		if !j.peeked.stale {
+			p := j.peeked
+			j.peeked = nil
+			j.stats.add(p.stats)
+			j.errors = append(j.errors, p.errors...)
+			if p.err == nil && p.offset != 0 {
+				j.last_entry_offset = p.offset
+			}
+			return p.offset, p.err
+		}
+
+		err := j._unpeek()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if j.online && j._onlineGrown() {
+		// Entries may already be linked from beyond the mapping
+		err := j._onlineRefresh()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	offset, err := j._next_matching_entry_offset_once(ctx)
+	if err != nil || offset != 0 || !j.online {
+		return offset, err
 	}
 
-	return r
+	// journald may have appended entries since, look once more
+	err = j._onlineRefresh()
+	if err != nil {
+		return 0, err
+	}
+	return j._next_matching_entry_offset_once(ctx)
 }
 
-func compare_seqnum_id(a [16]byte, b [16]byte) int {
-	for i := 0; i < 16; i++ {
-		if d := int(a[i]) - int(b[i]); d != 0 {
-			return d
+func (j *SdjournalReader) _next_matching_entry_offset_once(ctx context.Context) (uint64, error) {
+	for {
+		// Checked for every candidate, filters may skip many of them
+		err := ctx.Err()
+		if err != nil {
+			return 0, err
+		}
+
+		offset, err := j._next_entry_offset()
+		if err != nil || offset == 0 {
+			return offset, err
+		}
+
+		if j.has_window {
+			ended, err := j._windowEnded(offset)
+			if err != nil || ended {
+				return 0, err
+			}
+		}
+
+		if j._hasMatches() {
+			target, err := j._nextMatch(offset)
+			if err != nil || target == 0 {
+				return 0, err
+			}
+			if target != offset {
+				// Jump over the entries in between
+				err = j._seekEntry(target)
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+
+		ok, err := j._entryMatches(offset)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			j.last_entry_offset = offset
+			return offset, nil
 		}
 	}
-	return 0
 }
 
 /*
@@ -440,7 +2254,17 @@ func compare_seqnum_id(a [16]byte, b [16]byte) int {
  * read any further in the file.
  */
 func (j *SdjournalReader) Next() (map[string]string, bool, error) {
-	offset, err := j._next_entry_offset()
+	return j.NextContext(context.Background())
+}
+
+/*
+ * Like Next() but stops with the context error once ctx is cancelled.
+ *
+ * The context is checked before every entry, including the ones skipped
+ * by filters, so a long scan returns promptly.
+ */
+func (j *SdjournalReader) NextContext(ctx context.Context) (map[string]string, bool, error) {
+	offset, err := j._next_matching_entry_offset(ctx)
 
 	if err != nil {
 		return nil, false, err
@@ -449,26 +2273,501 @@ func (j *SdjournalReader) Next() (map[string]string, bool, error) {
 	if offset == uint64(0) {
 		return nil, false, nil
 	}
-	offsetdata, err := j._loadDataOffsetsFromEntry(offset)
+
+	r := make(map[string]string)
+
+	if j.include_meta {
+		err = j._metaFields(offset, func(name, value string) {
+			r[name] = value
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	_, err = j._readEntryFields(offset, func(name, value []byte) error {
+		put_field(r, j.duplicate_policy, j._string(name), j._string(value))
+		return nil
+	})
 	if err != nil {
 		return nil, false, err
 	}
+	return r, true, nil
+}
 
-	r := make(map[string]string)
+/*
+ * Like Next() but returns the field values as raw bytes.
+ *
+ * Values can contain arbitrary binary data, e.g. COREDUMP, which is
+ * kept intact here. Only the first '=' separates the name from the
+ * value.
+ */
+func (j *SdjournalReader) NextRaw() (map[string][]byte, bool, error) {
+	offset, err := j._next_matching_entry_offset(context.Background())
 
-	for i := 0; i < len(offsetdata); i++ {
-		buf, err := j._loadData(offsetdata[i])
+	if err != nil {
+		return nil, false, err
+	}
+
+	if offset == uint64(0) {
+		return nil, false, nil
+	}
+
+	r := make(map[string][]byte)
+
+	if j.include_meta {
+		err = j._metaFields(offset, func(name, value string) {
+			r[name] = []byte(value)
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	_, err = j._readEntryFields(offset, func(name, value []byte) error {
+		put_field(r, j.duplicate_policy, string(name), bytes.Clone(value))
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return r, true, nil
+}
+
+/*
+ * Like NextRaw() but returns the fields in on-disk order.
+ *
+ * A field name can occur more than once in an entry, which the maps
+ * returned by the other functions collapse to one value. This keeps all
+ * of them, so entries can be written out again unchanged.
+ */
+func (j *SdjournalReader) NextOrdered() ([]Field, bool, error) {
+	offset, err := j._next_matching_entry_offset(context.Background())
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if offset == uint64(0) {
+		return nil, false, nil
+	}
+
+	var r []Field
+
+	if j.include_meta {
+		err = j._metaFields(offset, func(name, value string) {
+			r = append(r, Field{Name: name, Value: []byte(value)})
+		})
 		if err != nil {
 			return nil, false, err
 		}
-		separated := strings.SplitN(string(buf), "=", 2)
-		name := separated[0]
-		value := separated[1]
-		r[name] = value
+	}
+
+	_, err = j._readEntryFields(offset, func(name, value []byte) error {
+		r = append(r, Field{Name: string(name), Value: bytes.Clone(value)})
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
 	}
 	return r, true, nil
 }
 
+/*
+ * Calls fn with the name and value of every field of the next entry, in
+ * on-disk order, without building a map. Returns false at the end.
+ *
+ * The slices point into the mapped file, or into a buffer reused for
+ * compressed fields, and are only valid until fn returns for compressed
+ * fields and until the next call otherwise. fn must copy what it keeps.
+ * An error returned by fn stops reading the entry and is returned.
+ */
+func (j *SdjournalReader) NextZeroCopy(fn func(name, value []byte) error) (bool, error) {
+	offset, err := j._next_matching_entry_offset(context.Background())
+
+	if err != nil {
+		return false, err
+	}
+
+	if offset == uint64(0) {
+		return false, nil
+	}
+
+	if j.include_meta {
+		var meta_err error
+		err = j._metaFields(offset, func(name, value string) {
+			if meta_err == nil {
+				meta_err = fn([]byte(name), []byte(value))
+			}
+		})
+		if err == nil {
+			err = meta_err
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = j._readEntryFields(offset, fn)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+/*
+ * Advances to the next entry and returns the value of its field with the
+ * given name, without reading its other fields. Returns false at the end.
+ *
+ * The value is nil if the entry has no such field and empty but not nil
+ * if the field is empty. If the field is repeated the first value on
+ * disk is returned. Like with NextZeroCopy() it may point into the
+ * mapped file or a reused buffer, and is only valid until the next call.
+ *
+ * Only the names of the other fields are looked at, compressed ones still
+ * have to be decompressed for that. The xor_hash of entries is not
+ * checked, as not all their data objects are read.
+ */
+func (j *SdjournalReader) NextField(name string) ([]byte, bool, error) {
+	offset, err := j._next_matching_entry_offset(context.Background())
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if offset == uint64(0) {
+		return nil, false, nil
+	}
+
+	if j.include_meta && IsSyntheticField(name) {
+		var value []byte
+		err = j._metaFields(offset, func(n, v string) {
+			if n == name {
+				value = []byte(v)
+			}
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		return value, true, nil
+	}
+
+	value, err := j._readEntryField(offset, name)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Returns the value of the named field of the entry at the given offset, nil if it has none
+func (j *SdjournalReader) _readEntryField(offset uint64, name string) ([]byte, error) {
+	offsetdata, err := j._loadDataOffsetsFromEntry(offset)
+	if err != nil {
+		return nil, err
+	}
+	j.stats.EntriesRead++
+
+	prefix := []byte(name + "=")
+	for _, data_offset := range offsetdata {
+		h, payload, err := j._loadDataObject(data_offset)
+		if err == nil && h.object.flags&_OBJECT_COMPRESSED_MASK != 0 {
+			payload, err = j._loadDataTo(data_offset, &j.scratch)
+		}
+		if err != nil {
+			err = j._skipField(offset, err)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if bytes.HasPrefix(payload, prefix) {
+			return payload[len(prefix):], nil
+		}
+	}
+	return nil, nil
+}
+
+/*
+ * Like Next() but also returns the metadata stored in the entry object:
+ * seqnum, realtime and monotonic timestamps and boot id.
+ */
+func (j *SdjournalReader) NextEntry() (*Entry, bool, error) {
+	offset, err := j._next_matching_entry_offset(context.Background())
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if offset == uint64(0) {
+		return nil, false, nil
+	}
+
+	entry, err := j._readEntry(offset)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+/*
+ * The outcome of looking up the next entry ahead, kept by Peek() until
+ * the entry is consumed. The iterator has moved past the entry already,
+ * the position before is kept to go back when filters change.
+ */
+type peekedEntry struct {
+	offset uint64
+	err    error
+
+	// The work of the lookup, accounted once the entry is consumed
+	stats  ReaderStats
+	errors []error
+
+	entry     *Entry
+	entry_err error
+
+	started        bool
+	array_offset   uint64
+	array_iterator uint64
+
+	// Filters changed since, the lookup has to be done again
+	stale bool
+}
+
+/*
+ * Returns the entry the next call to NextEntry() or Next() would return,
+ * without consuming it, e.g. to merge several readers by timestamp.
+ *
+ * The outcome, an error included, is kept: peeking again returns it
+ * without reading anything, and the next call consumes it without
+ * looking the entry up again. Stats() and Errors() only count the work
+ * once the entry is consumed. Seeking drops the peeked entry, changing
+ * the filters makes the next call look it up again.
+ */
+func (j *SdjournalReader) Peek() (*Entry, bool, error) {
+	if !j.opened {
+		return nil, false, fmt.Errorf("This object hasn't been opened")
+	}
+
+	if j.peeked != nil && j.peeked.stale {
+		err := j._unpeek()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if j.peeked == nil {
+		j._peek()
+	}
+
+	p := j.peeked
+	if p.err != nil {
+		return nil, false, p.err
+	}
+	if p.entry_err != nil {
+		return nil, false, p.entry_err
+	}
+	return p.entry, p.offset != 0, nil
+}
+
+/*
+ * Looks up the next entry and reads it into j.peeked, leaving the
+ * counters and errors of the reader as they were.
+ */
+func (j *SdjournalReader) _peek() {
+	p := &peekedEntry{
+		started:        j.entryarray != nil,
+		array_offset:   j.entry_array_offset,
+		array_iterator: j.array_iterator,
+	}
+	stats := j.stats
+	n_errors := len(j.errors)
+	last := j.last_entry_offset
+
+	p.offset, p.err = j._next_matching_entry_offset(context.Background())
+	p.stats = j.stats.sub(stats)
+	p.errors = slices.Clone(j.errors[n_errors:])
+
+	// The consumer reads the entry again, for its own format
+	if p.err == nil && p.offset != 0 {
+		p.entry, p.entry_err = j._readEntry(p.offset)
+	}
+
+	j.stats = stats
+	j.errors = j.errors[:n_errors]
+	j.last_entry_offset = last
+	j.peeked = p
+}
+
+// Moves the iterator back to before the peeked entry and forgets it
+func (j *SdjournalReader) _unpeek() error {
+	p := j.peeked
+	j.peeked = nil
+
+	// The array is loaded again, an online reader may have remapped
+	if !p.started {
+		j.entryarray = nil
+		j.array_iterator = 0
+		return nil
+	}
+	err := j._loadEntryArrayObject(p.array_offset)
+	if err != nil {
+		return err
+	}
+	j.array_iterator = p.array_iterator
+	return nil
+}
+
+/*
+ * Makes the matches be resolved to data objects again and a peeked entry
+ * be looked up again, with the new filters.
+ */
+func (j *SdjournalReader) _filtersChanged() {
+	j.match_terms = nil
+	if j.peeked != nil {
+		j.peeked.stale = true
+	}
+}
+
+func (j *SdjournalReader) _readEntry(offset uint64) (*Entry, error) {
+	h, err := j._loadEntryObject(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		Fields:    make(map[string]string),
+		SeqnumID:  j.header.seqnum_id,
+		Seqnum:    h.seqnum,
+		Realtime:  h.realtime,
+		Monotonic: h.monotonic,
+		BootID:    h.boot_id,
+	}
+
+	entry.Skipped, err = j._readEntryFields(offset, func(name, value []byte) error {
+		put_field(entry.Fields, j.duplicate_policy, j._string(name), j._string(value))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+/*
+ * Calls fn with the name and value of every field of the entry at the
+ * given offset, in on-disk order, and returns the number of fields
+ * skipped in lenient mode.
+ *
+ * The slices may point into the mapped file or into the scratch buffer
+ * reused for the next compressed field, fn must copy them to keep them.
+ */
+func (j *SdjournalReader) _readEntryFields(offset uint64, fn func(name, value []byte) error) (int, error) {
+	offsetdata, err := j._loadDataOffsetsFromEntry(offset)
+	if err != nil {
+		return 0, err
+	}
+	j.stats.EntriesRead++
+
+	skipped := 0
+	xor_hash := uint64(0)
+	for i := 0; i < len(offsetdata); i++ {
+		// Also fails for offsets pointing to anything but a data object
+		buf, err := j._loadDataTo(offsetdata[i], &j.scratch)
+		if err != nil {
+			err = j._skipField(offset, err)
+			if err != nil {
+				return skipped, err
+			}
+			skipped++
+			continue
+		}
+		if j.verify_xor_hash {
+			hash, err := j._entryItemHash(offsetdata[i], buf)
+			if err != nil {
+				return skipped, err
+			}
+			xor_hash ^= hash
+		}
+		sep := bytes.IndexByte(buf, '=')
+		if sep < 0 {
+			err = j._skipField(offset, fmt.Errorf("Data object at %d has no field separator", offsetdata[i]))
+			if err != nil {
+				return skipped, err
+			}
+			skipped++
+			continue
+		}
+		if j.strict_field_names && !ValidFieldName(string(buf[:sep])) {
+			err = j._skipField(offset, fmt.Errorf("Data object at %d has invalid field name %q", offsetdata[i], buf[:sep]))
+			if err != nil {
+				return skipped, err
+			}
+			skipped++
+			continue
+		}
+		if j.field_filter != nil && !j.field_filter[string(buf[:sep])] {
+			continue
+		}
+		err = fn(buf[:sep], buf[sep+1:])
+		if err != nil {
+			return skipped, err
+		}
+	}
+
+	// Skipped fields are missing from the hash, they are reported already
+	if j.verify_xor_hash && skipped == 0 {
+		err = j._checkXorHash(offset, xor_hash)
+		if err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
+
+/*
+ * In lenient mode fields whose data object can't be read, e.g. because
+ * decompression fails or the entry points to an object that is not a
+ * data object, are left out of the entry and iteration goes on. Entry
+ * counts them in Skipped.
+ * The errors are collected and can be retrieved with Errors().
+ *
+ * This is meant for recovering what is left of partially corrupt
+ * journals. Broken entry arrays and entry objects still stop the
+ * iteration, see RecoverEntries() for those. Set before Open() to also
+ * open files whose first entry array is broken.
+ */
+func (j *SdjournalReader) SetLenient(lenient bool) {
+	j.lenient = lenient
+	j._filtersChanged()
+}
+
+// Returns the errors of the fields skipped in lenient mode, oldest first
+func (j *SdjournalReader) Errors() []error {
+	return j.errors
+}
+
+/*
+ * Returns what Open() found about the file that may make reading parts
+ * of it fail later on, such as compression this reader doesn't support.
+ * Such files are still opened, as most of their fields are usually
+ * readable.
+ */
+func (j *SdjournalReader) Warnings() []string {
+	return j.warnings
+}
+
+/*
+ * Handles a field of the entry at the given offset that couldn't be read.
+ * Returns nil if the field is to be skipped, in lenient mode, and the
+ * error otherwise.
+ */
+func (j *SdjournalReader) _skipField(offset uint64, err error) error {
+	if !j.lenient {
+		return err
+	}
+	j.errors = append(j.errors, fmt.Errorf("Entry at %d: %w", offset, err))
+	return nil
+}
+
 func main() {
 	j := SdjournalReader{}
 	err := j.Open(os.Args[1])
@@ -479,7 +2778,7 @@ func main() {
 
 	for true {
 		data, hasnext, err := j.Next()
-		if ! hasnext || err != nil{
+		if !hasnext || err != nil {
 			break
 		}
 		fmt.Println(data)
@@ -0,0 +1,471 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+ * The fixtures in testdata were written by journald 252, with a small
+ * RuntimeMaxFileSize and cut after the last object:
+ *
+ *	regular.journal  not compact, Jenkins hashes
+ *	compact.journal  compact, keyed hashes
+ *
+ * Both hold 35 entries with the same messages, among them a field with a
+ * binary value and a 2000 byte message. The arena size in the header is
+ * adjusted to the cut, journalctl --verify passes.
+ *
+ * malformed.journal is regular.journal with the '=' of the MESSAGE of
+ * its first entry, which no other entry shares, overwritten with '_'.
+ *
+ * empty.journal is a valid journal without entries: the header and the
+ * two empty hash tables, entry_array_offset is 0.
+ */
+const FIXTURE_ENTRIES = 35
+
+func fixture(name string) string {
+	return filepath.Join("testdata", name)
+}
+
+func open_fixture(t testing.TB, name string) *SdjournalReader {
+	t.Helper()
+
+	j := &SdjournalReader{}
+	err := j.Open(fixture(name))
+	if err != nil {
+		t.Fatalf("Open(%s): %v", name, err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+// The data object with the MESSAGE of the first entry
+const MALFORMED_DATA_OFFSET = 39272
+
+func TestMalformedFieldStrict(t *testing.T) {
+	j := open_fixture(t, "malformed.journal")
+
+	_, ok, err := j.Next()
+	if err == nil || ok {
+		t.Fatalf("Next() = %v, %v, want an error", ok, err)
+	}
+	if !strings.Contains(err.Error(), "has no field separator") {
+		t.Fatalf("Next() failed with %v, want the missing separator", err)
+	}
+}
+
+func TestMalformedFieldLenient(t *testing.T) {
+	j := open_fixture(t, "malformed.journal")
+	j.SetLenient(true)
+
+	entries := read_all(t, j)
+	if len(entries) != FIXTURE_ENTRIES {
+		t.Fatalf("Read %d entries, want %d", len(entries), FIXTURE_ENTRIES)
+	}
+
+	first := entries[0]
+	if first.Skipped != 1 || first.Fields["MESSAGE"] != "" || first.Fields["PRIORITY"] == "" {
+		t.Fatalf("First entry skipped %d fields, has %d, want only MESSAGE left out", first.Skipped, len(first.Fields))
+	}
+	for i, entry := range entries[1:] {
+		if entry.Skipped != 0 || entry.Fields["MESSAGE"] == "" {
+			t.Fatalf("Entry %d skipped %d fields", i+1, entry.Skipped)
+		}
+	}
+
+	errors := j.Errors()
+	want := fmt.Sprintf("Data object at %d has no field separator", MALFORMED_DATA_OFFSET)
+	if len(errors) != 1 || !strings.Contains(errors[0].Error(), want) {
+		t.Fatalf("Errors() = %v, want %q", errors, want)
+	}
+}
+
+// Every way of reading the malformed entry fails, none panics
+func TestMalformedFieldReaders(t *testing.T) {
+	reads := []struct {
+		name string
+		read func(j *SdjournalReader) error
+	}{
+		{"Next", func(j *SdjournalReader) error {
+			_, _, err := j.Next()
+			return err
+		}},
+		{"NextEntry", func(j *SdjournalReader) error {
+			_, _, err := j.NextEntry()
+			return err
+		}},
+		{"NextOrdered", func(j *SdjournalReader) error {
+			_, _, err := j.NextOrdered()
+			return err
+		}},
+		{"WriteExport", func(j *SdjournalReader) error {
+			return j.WriteExport(io.Discard)
+		}},
+		{"TextReader", func(j *SdjournalReader) error {
+			_, err := io.Copy(io.Discard, j.TextReader())
+			return err
+		}},
+		{"CountByField", func(j *SdjournalReader) error {
+			_, err := j.CountByField("MESSAGE")
+			return err
+		}},
+		{"QueryUnique", func(j *SdjournalReader) error {
+			_, err := j.QueryUnique("MESSAGE")
+			return err
+		}},
+	}
+
+	for _, r := range reads {
+		j := open_fixture(t, "malformed.journal")
+		err := r.read(j)
+		if err == nil {
+			t.Errorf("%s succeeded on the malformed journal", r.name)
+		}
+	}
+}
+
+func TestEmptyJournal(t *testing.T) {
+	j := open_fixture(t, "empty.journal")
+
+	entry, ok, err := j.Next()
+	if entry != nil || ok || err != nil {
+		t.Fatalf("Next() = %v, %v, %v, want nil, false, nil", entry, ok, err)
+	}
+
+	// There is no Previous(), reading on from the tail sees no entries either
+	err = j.SeekTail()
+	if err != nil {
+		t.Fatalf("SeekTail(): %v", err)
+	}
+	entry, ok, err = j.Next()
+	if entry != nil || ok || err != nil {
+		t.Fatalf("Next() after SeekTail() = %v, %v, %v, want nil, false, nil", entry, ok, err)
+	}
+
+	err = j.SeekTailMinus(3)
+	if err != nil {
+		t.Fatalf("SeekTailMinus(3): %v", err)
+	}
+	fields, ok, err := j.NextOrdered()
+	if fields != nil || ok || err != nil {
+		t.Fatalf("NextOrdered() = %v, %v, %v, want nil, false, nil", fields, ok, err)
+	}
+
+	index, err := j.BuildEntryIndex()
+	if len(index) != 0 || err != nil {
+		t.Fatalf("BuildEntryIndex() = %v, %v, want no entries", index, err)
+	}
+
+	for entry, err := range j.All() {
+		t.Fatalf("All() yields %v, %v", entry, err)
+	}
+}
+
+/*
+ * Walks the entry arrays and the data items of the entries with the item
+ * size helpers, 4 byte offsets in compact files, 8 byte offsets and 16
+ * byte offset and hash pairs otherwise.
+ */
+func TestItemSizes(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry_item uint64
+		data_item  uint64
+	}{
+		{"regular.journal", 8, 16},
+		{"compact.journal", 4, 4},
+	}
+
+	for _, test := range tests {
+		j := open_fixture(t, test.name)
+		if j._entryArrayItemSize() != test.entry_item || j._dataArrayItemSize() != test.data_item {
+			t.Fatalf("%s: item sizes %d and %d, want %d and %d", test.name, j._entryArrayItemSize(), j._dataArrayItemSize(), test.entry_item, test.data_item)
+		}
+
+		var seqnum uint64
+		n := 0
+		array_offset := j.header.entry_array_offset
+		for array_offset != 0 {
+			h, items, err := j._entryArrayAt(array_offset)
+			if err != nil {
+				t.Fatalf("%s: entry array at %d: %v", test.name, array_offset, err)
+			}
+			if j._entryArrayCapacity(h)*test.entry_item != h.object.size-ENTRY_ARRAY_OBJECT_SIZE {
+				t.Fatalf("%s: entry array at %d has %d items for %d bytes", test.name, array_offset, j._entryArrayCapacity(h), h.object.size)
+			}
+
+			for i := uint64(0); i < j._entryArrayUsed(h, items); i++ {
+				offset := j._entryArrayItem(items, i)
+				e, err := j._loadEntryObject(offset)
+				if err != nil {
+					t.Fatalf("%s: entry %d at %d: %v", test.name, n, offset, err)
+				}
+				if e.seqnum <= seqnum {
+					t.Fatalf("%s: entry %d has seqnum %d after %d", test.name, n, e.seqnum, seqnum)
+				}
+				seqnum = e.seqnum
+
+				data, err := j._loadDataOffsetsFromEntry(offset)
+				if err != nil {
+					t.Fatalf("%s: entry %d: %v", test.name, n, err)
+				}
+				if uint64(len(data))*test.data_item != e.object.size-ENTRY_OBJECT_SIZE {
+					t.Fatalf("%s: entry %d has %d data items for %d bytes", test.name, n, len(data), e.object.size)
+				}
+				for _, data_offset := range data {
+					_, err = j._loadDataFieldName(data_offset)
+					if err != nil {
+						t.Fatalf("%s: entry %d: %v", test.name, n, err)
+					}
+				}
+				n++
+			}
+
+			array_offset, err = _nextEntryArray(array_offset, h)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n != FIXTURE_ENTRIES {
+			t.Fatalf("%s: walked %d entries, want %d", test.name, n, FIXTURE_ENTRIES)
+		}
+	}
+}
+
+// The ZSTD compressed data object of regular.journal, the long MESSAGE
+const ZSTD_DATA_OFFSET = 70960
+
+/*
+ * Decompressing with the decoder of the reader against creating one per
+ * object, as _loadData() used to.
+ */
+func BenchmarkZstdDecoder(b *testing.B) {
+	j := open_fixture(b, "regular.journal")
+	_, payload, err := j._loadDataObject(ZSTD_DATA_OFFSET)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("reused", func(b *testing.B) {
+		b.ReportAllocs()
+		var scratch []byte
+		for i := 0; i < b.N; i++ {
+			_, err := j._loadDataTo(ZSTD_DATA_OFFSET, &scratch)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("per object", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			decoder, err := zstd.NewReader(nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, err = decoder.DecodeAll(payload, nil)
+			decoder.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+/*
+ * Reads every entry of the regular fixture per iteration, with Next()
+ * building a map per entry and with NextZeroCopy() handing out slices.
+ */
+func BenchmarkNext(b *testing.B) {
+	j := open_fixture(b, "regular.journal")
+
+	b.Run("Next", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			err := j.Reset()
+			if err != nil {
+				b.Fatal(err)
+			}
+			for {
+				_, ok, err := j.Next()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !ok {
+					break
+				}
+			}
+		}
+	})
+
+	b.Run("NextZeroCopy", func(b *testing.B) {
+		b.ReportAllocs()
+		n := 0
+		count := func(name, value []byte) error {
+			n += len(value)
+			return nil
+		}
+		for i := 0; i < b.N; i++ {
+			err := j.Reset()
+			if err != nil {
+				b.Fatal(err)
+			}
+			for {
+				ok, err := j.NextZeroCopy(count)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !ok {
+					break
+				}
+			}
+		}
+	})
+}
+
+/*
+ * The priority check reads the PRIORITY of every entry, in lenient mode
+ * the entries where it is broken are skipped rather than stopping.
+ * Breaks the PRIORITY=0 of the regular fixture in a copy.
+ */
+func TestBrokenPriorityLenient(t *testing.T) {
+	regular := open_fixture(t, "regular.journal")
+	offset, found, err := regular.lookupData([]byte("PRIORITY=0"))
+	if err != nil || !found {
+		t.Fatalf("lookupData(PRIORITY=0) = %v, %v", found, err)
+	}
+
+	data, err := os.ReadFile(fixture("regular.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset+DATA_OBJECT_SIZE+uint64(len("PRIORITY"))] = '_'
+	path := filepath.Join(t.TempDir(), "priority.journal")
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := &SdjournalReader{}
+	err = j.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	j.SetLenient(true)
+	j.SetMaxPriority(PRIORITY_DEFAULT)
+
+	// 3 entries have PRIORITY=0, 3 more PRIORITY=7
+	entries := read_all(t, j)
+	if len(entries) != FIXTURE_ENTRIES-6 {
+		t.Fatalf("Read %d entries, want %d", len(entries), FIXTURE_ENTRIES-6)
+	}
+	for _, entry := range entries {
+		if entry.Fields["PRIORITY"] == "" || entry.Fields["PRIORITY"] == "7" {
+			t.Fatalf("Entry %d has PRIORITY %q", entry.Seqnum, entry.Fields["PRIORITY"])
+		}
+	}
+
+	want := fmt.Sprintf("Data object at %d has no field separator", offset)
+	errors := j.Errors()
+	if len(errors) != 3 || !strings.Contains(errors[0].Error(), want) {
+		t.Fatalf("Errors() = %v, want 3 times %q", errors, want)
+	}
+}
+
+func TestState(t *testing.T) {
+	j := &SdjournalReader{}
+	if j.State() != 0 || j.IsClean() {
+		t.Fatalf("State() = %d, IsClean() = %v before Open()", j.State(), j.IsClean())
+	}
+
+	j = open_fixture(t, "regular.journal")
+	if j.State() != STATE_OFFLINE || !j.IsClean() {
+		t.Fatalf("State() = %d, IsClean() = %v, want offline and clean", j.State(), j.IsClean())
+	}
+
+	// journald crashed while writing
+	data, err := os.ReadFile(fixture("regular.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[unsafe.Offsetof(j.header.state)] = STATE_ONLINE
+	path := filepath.Join(t.TempDir(), "online.journal")
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	online := &SdjournalReader{}
+	err = online.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer online.Close()
+	if online.State() != STATE_ONLINE || online.IsClean() {
+		t.Fatalf("State() = %d, IsClean() = %v, want online and not clean", online.State(), online.IsClean())
+	}
+}
+
+func TestTailBootID(t *testing.T) {
+	const boot = "ffdd4ecbf211407eab561b5bb3bab56e"
+
+	// Written by journald 252, the last entry is read
+	for _, name := range []string{"regular.journal", "compact.journal"} {
+		j := open_fixture(t, name)
+		id, err := j.TailBootID()
+		if err != nil || id.String() != boot {
+			t.Fatalf("%s: TailBootID() = %s, %v, want %s", name, id, err, boot)
+		}
+	}
+
+	j := open_fixture(t, "empty.journal")
+	id, err := j.TailBootID()
+	if err != nil || id != (ID128{}) {
+		t.Fatalf("empty.journal: TailBootID() = %s, %v, want the zero id", id, err)
+	}
+
+	// From journald 254 on the header has it
+	data, err := os.ReadFile(fixture("regular.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compatible := unsafe.Offsetof(j.header.compatible_flags)
+	binary.LittleEndian.PutUint32(data[compatible:], HEADER_COMPATIBLE_TAIL_ENTRY_BOOT_ID)
+	tail_boot := unsafe.Offsetof(j.header.tail_entry_boot_id)
+	copy(data[tail_boot:tail_boot+16], bytes.Repeat([]byte{0xab}, 16))
+	path := filepath.Join(t.TempDir(), "tail.journal")
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j = &SdjournalReader{}
+	err = j.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	id, err = j.TailBootID()
+	if err != nil || id.String() != strings.Repeat("ab", 16) {
+		t.Fatalf("TailBootID() = %s, %v, want the one of the header", id, err)
+	}
+}
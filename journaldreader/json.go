@@ -0,0 +1,202 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+const json_hex = "0123456789abcdef"
+
+// Appends s as a JSON string, invalid UTF-8 becomes U+FFFD
+func append_json_string(buf *bytes.Buffer, s []byte) {
+	buf.WriteByte('"')
+	for len(s) > 0 {
+		r, size := utf8.DecodeRune(s)
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(byte(r))
+		case r == '\n':
+			buf.WriteString("\\n")
+		case r == '\t':
+			buf.WriteString("\\t")
+		case r == '\r':
+			buf.WriteString("\\r")
+		case r < ' ':
+			buf.WriteString("\\u00")
+			buf.WriteByte(json_hex[r>>4])
+			buf.WriteByte(json_hex[r&0xf])
+		case r == utf8.RuneError && size == 1:
+			buf.WriteRune(utf8.RuneError)
+		default:
+			buf.Write(s[:size])
+		}
+		s = s[size:]
+	}
+	buf.WriteByte('"')
+}
+
+/*
+ * Appends a field value the way journalctl -o json does: a string when
+ * it is printable UTF-8, newlines included, an array of the byte values
+ * otherwise.
+ */
+func append_json_value(buf *bytes.Buffer, value []byte) {
+	if utf8_is_printable(value, true) {
+		append_json_string(buf, value)
+		return
+	}
+
+	buf.WriteByte('[')
+	for i, b := range value {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.Itoa(int(b)))
+	}
+	buf.WriteByte(']')
+}
+
+/*
+ * Appends the entry at the given offset to buf as a JSON object, as
+ * journalctl -o json --all does: the synthetic fields and _BOOT_ID
+ * first, then the fields in on-disk order. A field repeated in the entry
+ * becomes an array of its values.
+ */
+func (j *SdjournalReader) _appendJSONEntry(buf *bytes.Buffer, offset uint64) error {
+	type field struct {
+		name   string
+		values [][]byte
+	}
+	var fields []field
+	index := make(map[string]int)
+
+	_, err := j._readEntryFields(offset, func(name, value []byte) error {
+		// Written from the entry object
+		if string(name) == "_BOOT_ID" {
+			return nil
+		}
+
+		// The value may be in the scratch buffer, encode it right away
+		var v bytes.Buffer
+		append_json_value(&v, value)
+
+		i, ok := index[string(name)]
+		if !ok {
+			i = len(fields)
+			index[string(name)] = i
+			fields = append(fields, field{name: string(name)})
+		}
+		fields[i].values = append(fields[i].values, v.Bytes())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h, err := j._loadEntryObject(offset)
+	if err != nil {
+		return err
+	}
+
+	buf.WriteString(`{"` + FIELD_CURSOR + `":"`)
+	buf.WriteString(j._cursor(h))
+	buf.WriteString(`","` + FIELD_REALTIME_TIMESTAMP + `":"`)
+	buf.WriteString(strconv.FormatUint(h.realtime, 10))
+	buf.WriteString(`","` + FIELD_MONOTONIC_TIMESTAMP + `":"`)
+	buf.WriteString(strconv.FormatUint(h.monotonic, 10))
+	buf.WriteString(`","` + FIELD_SEQNUM + `":"`)
+	buf.WriteString(strconv.FormatUint(h.seqnum, 10))
+	buf.WriteString(`","` + FIELD_SEQNUM_ID + `":"`)
+	buf.WriteString(ID128String(j.header.seqnum_id))
+	buf.WriteString(`","_BOOT_ID":"`)
+	buf.WriteString(ID128String(h.boot_id))
+	buf.WriteByte('"')
+
+	for _, f := range fields {
+		buf.WriteByte(',')
+		append_json_string(buf, []byte(f.name))
+		buf.WriteByte(':')
+		if len(f.values) == 1 {
+			buf.Write(f.values[0])
+			continue
+		}
+		buf.WriteByte('[')
+		for i, v := range f.values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(v)
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+/*
+ * Returns the next entry as a JSON object, in the format of journalctl
+ * -o json, see _appendJSONEntry(). Unlike journalctl without --all,
+ * large fields are kept rather than replaced with null.
+ *
+ * Numbers are strings, as with journalctl, and binary values arrays of
+ * bytes.
+ */
+func (j *SdjournalReader) NextJSON() ([]byte, bool, error) {
+	offset, err := j._next_matching_entry_offset(context.Background())
+	if err != nil {
+		return nil, false, err
+	}
+	if offset == 0 {
+		return nil, false, nil
+	}
+
+	var buf bytes.Buffer
+	err = j._appendJSONEntry(&buf, offset)
+	if err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+/*
+ * Writes every remaining entry to w as newline delimited JSON, one
+ * NextJSON() object per line, as log shippers expect. The output is
+ * buffered, on errors whatever was buffered is still flushed as far as
+ * possible.
+ */
+func (j *SdjournalReader) WriteNDJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var buf bytes.Buffer
+
+	for {
+		offset, err := j._next_matching_entry_offset(context.Background())
+		if err == nil && offset == 0 {
+			return bw.Flush()
+		}
+
+		if err == nil {
+			buf.Reset()
+			err = j._appendJSONEntry(&buf, offset)
+		}
+		if err == nil {
+			buf.WriteByte('\n')
+			_, err = bw.Write(buf.Bytes())
+		}
+		if err != nil {
+			bw.Flush()
+			return err
+		}
+	}
+}
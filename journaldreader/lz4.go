@@ -0,0 +1,139 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+ * Every input byte of an LZ4 block yields at most this many output bytes,
+ * a longer declared size can't be right.
+ */
+const LZ4_MAX_RATIO = 255
+
+/*
+ * Decompresses the payload of an LZ4 compressed data object: the
+ * little-endian 64 bit size of the decompressed data followed by a raw
+ * LZ4 block.
+ *
+ * The output buffer is allocated at the declared size once it is known
+ * to be possible, unless dst is large enough, and the block must fill it
+ * exactly, using up all the input. Anything else means the object is
+ * corrupt. Declared sizes above max are refused, 0 means no limit.
+ */
+func lz4_decompress(src []byte, dst []byte, max uint64) ([]byte, error) {
+	if len(src) < 9 {
+		return nil, fmt.Errorf("LZ4 payload of %d bytes is too short", len(src))
+	}
+	size := binary.LittleEndian.Uint64(src)
+	block := src[8:]
+
+	if size > uint64(len(block))*LZ4_MAX_RATIO {
+		return nil, fmt.Errorf("LZ4 payload of %d bytes can't decompress to the declared %d bytes", len(block), size)
+	}
+	if max != 0 && size > max {
+		return nil, fmt.Errorf("LZ4 payload decompresses to %d bytes, more than the limit of %d", size, max)
+	}
+
+	if uint64(cap(dst)) >= size {
+		dst = dst[:size]
+	} else {
+		dst = make([]byte, size)
+	}
+	n, err := lz4_decompress_block(block, dst)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(dst) {
+		return nil, fmt.Errorf("LZ4 payload decompressed to %d bytes, %d declared", n, size)
+	}
+	return dst, nil
+}
+
+/*
+ * Decompresses a raw LZ4 block into dst, returning the number of bytes
+ * written. Fails if the block is malformed, references data before the
+ * start of the output, doesn't fit into dst or doesn't end exactly at
+ * the end of src.
+ */
+func lz4_decompress_block(src []byte, dst []byte) (int, error) {
+	s, d := 0, 0
+
+	// Lengths of 15 continue in the following bytes until one isn't 255
+	length := func(n int) (int, error) {
+		if n != 15 {
+			return n, nil
+		}
+		for {
+			if s >= len(src) {
+				return 0, fmt.Errorf("LZ4 block ends within a length")
+			}
+			b := src[s]
+			s++
+			n += int(b)
+			if n > len(dst) {
+				return 0, fmt.Errorf("LZ4 block runs past the declared size")
+			}
+			if b != 255 {
+				return n, nil
+			}
+		}
+	}
+
+	for {
+		if s >= len(src) {
+			return 0, fmt.Errorf("LZ4 block ends without its last literals")
+		}
+		token := src[s]
+		s++
+
+		literals, err := length(int(token >> 4))
+		if err != nil {
+			return 0, err
+		}
+		if literals > len(src)-s {
+			return 0, fmt.Errorf("LZ4 block ends within literals")
+		}
+		if literals > len(dst)-d {
+			return 0, fmt.Errorf("LZ4 block runs past the declared size")
+		}
+		d += copy(dst[d:], src[s:s+literals])
+		s += literals
+
+		// The last sequence only has literals
+		if s == len(src) {
+			return d, nil
+		}
+
+		if len(src)-s < 2 {
+			return 0, fmt.Errorf("LZ4 block ends within a match offset")
+		}
+		offset := int(binary.LittleEndian.Uint16(src[s:]))
+		s += 2
+		if offset == 0 || offset > d {
+			return 0, fmt.Errorf("LZ4 match offset %d is outside the %d bytes decompressed", offset, d)
+		}
+
+		match, err := length(int(token & 15))
+		if err != nil {
+			return 0, err
+		}
+		match += 4
+		if match > len(dst)-d {
+			return 0, fmt.Errorf("LZ4 block runs past the declared size")
+		}
+
+		// Matches may overlap the bytes they produce
+		for i := 0; i < match; i++ {
+			dst[d] = dst[d-offset]
+			d++
+		}
+	}
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+
+package journaldreader
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+/*
+ * The fixtures are too small for read ahead to matter, point this at a
+ * large journal to measure it.
+ */
+const BENCH_JOURNAL_ENV = "JOURNALDREADER_BENCH_JOURNAL"
+
+func page_faults(b *testing.B) (minor, major int64) {
+	var ru unix.Rusage
+	err := unix.Getrusage(unix.RUSAGE_SELF, &ru)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return ru.Minflt, ru.Majflt
+}
+
+// Drops the file from the page cache, so that reading it faults again
+func evict(b *testing.B, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	err = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+/*
+ * Reads a journal front to back, out of the page cache, with each access
+ * pattern and reports the page faults taken per iteration.
+ */
+func BenchmarkAccessPattern(b *testing.B) {
+	path := os.Getenv(BENCH_JOURNAL_ENV)
+	if path == "" {
+		path = fixture("regular.journal")
+	}
+
+	patterns := []struct {
+		name    string
+		pattern AccessPattern
+	}{
+		{"normal", ACCESS_NORMAL},
+		{"sequential", ACCESS_SEQUENTIAL},
+		{"random", ACCESS_RANDOM},
+	}
+	for _, p := range patterns {
+		b.Run(p.name, func(b *testing.B) {
+			var minor, major int64
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				evict(b, path)
+				b.StartTimer()
+
+				minor0, major0 := page_faults(b)
+				j := &SdjournalReader{}
+				err := j.Open(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				j.SetAccessPattern(p.pattern)
+				for {
+					ok, err := j.NextZeroCopy(func(name, value []byte) error { return nil })
+					if err != nil {
+						b.Fatal(err)
+					}
+					if !ok {
+						break
+					}
+				}
+				j.Close()
+				minor1, major1 := page_faults(b)
+				minor += minor1 - minor0
+				major += major1 - major0
+			}
+			b.ReportMetric(float64(minor)/float64(b.N), "minflt/op")
+			b.ReportMetric(float64(major)/float64(b.N), "majflt/op")
+		})
+	}
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || solaris
+
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+
+package journaldreader
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func madvise(data []byte, p AccessPattern) {
+	if len(data) == 0 {
+		return
+	}
+
+	advice := unix.MADV_NORMAL
+	switch p {
+	case ACCESS_SEQUENTIAL:
+		advice = unix.MADV_SEQUENTIAL
+	case ACCESS_RANDOM:
+		advice = unix.MADV_RANDOM
+	}
+	unix.Madvise(data, advice)
+}
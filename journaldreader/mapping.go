@@ -0,0 +1,141 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+// How the mapped file is going to be read, passed to the kernel as a hint
+type AccessPattern int
+
+const (
+	ACCESS_NORMAL AccessPattern = iota
+	ACCESS_SEQUENTIAL
+	ACCESS_RANDOM
+)
+
+/*
+ * Tells the kernel how the file is going to be read, so that it reads
+ * ahead for ACCESS_SEQUENTIAL, the default, or doesn't for ACCESS_RANDOM,
+ * e.g. for many seeks or matches on a large file.
+ *
+ * The pattern applies to the mapping, which is shared with clones. It
+ * has no effect on files read with OpenReaderAt() or decompressed in
+ * memory, nor on platforms without madvise.
+ */
+func (j *SdjournalReader) SetAccessPattern(p AccessPattern) {
+	if j.mapping != nil && !j.closed {
+		j.mapping.advise(p)
+	}
+}
+
+/*
+ * The mapped journal file, shared by every reader iterating over it.
+ *
+ * Each reader holds one reference. The file is unmapped and its
+ * descriptor closed, unless borrowed, when the last reference is
+ * released.
+ */
+type sharedMapping struct {
+	mu      sync.Mutex
+	fd      *os.File
+	data    mmap.MMap
+	refs    int
+	pattern AccessPattern
+
+	// The caller owns fd, it is not closed with the mapping
+	borrowed bool
+}
+
+// Full iteration is the common case, the mapping starts out sequential
+func newSharedMapping(fd *os.File, data mmap.MMap) *sharedMapping {
+	m := &sharedMapping{fd: fd, data: data, refs: 1, pattern: ACCESS_SEQUENTIAL}
+	madvise(data, m.pattern)
+	return m
+}
+
+/*
+ * Passes the access pattern to the kernel. This is only a hint, failures
+ * are ignored.
+ */
+func (m *sharedMapping) advise(p AccessPattern) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pattern = p
+	madvise(m.data, p)
+}
+
+func (m *sharedMapping) acquire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refs++
+}
+
+func (m *sharedMapping) release() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.refs <= 0 {
+		return fmt.Errorf("The mapping has been released already")
+	}
+	m.refs--
+	if m.refs > 0 {
+		return nil
+	}
+
+	err := m.data.Unmap()
+	if !m.borrowed {
+		m.fd.Close()
+	}
+	return err
+}
+
+/*
+ * Maps the file again to pick up data appended since it was mapped.
+ *
+ * Only possible while a single reader uses the mapping, the others would
+ * be left with the old, unmapped memory.
+ */
+func (m *sharedMapping) remap() (mmap.MMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.refs != 1 {
+		return nil, fmt.Errorf("Cannot remap a mapping shared with other readers")
+	}
+
+	data, err := mmap.Map(m.fd, mmap.RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	madvise(data, m.pattern)
+
+	err = m.data.Unmap()
+	m.data = data
+	return data, err
+}
+
+// Releases a reference, but only if it isn't the last one
+func (m *sharedMapping) detach() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.refs <= 1 {
+		return fmt.Errorf("Cannot detach the last reference to the mapping")
+	}
+	m.refs--
+	return nil
+}
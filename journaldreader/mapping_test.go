@@ -0,0 +1,60 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"testing"
+)
+
+func TestDetach(t *testing.T) {
+	j := &SdjournalReader{}
+	err := j.Open(fixture("regular.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last reference can't be detached, it would never be unmapped
+	err = j.Detach()
+	if err == nil {
+		t.Fatalf("Detach() of the only reader succeeded")
+	}
+
+	c, err := j.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := j.mapping
+	if m.refs != 2 {
+		t.Fatalf("%d references after Clone(), want 2", m.refs)
+	}
+
+	err = j.Detach()
+	if err != nil {
+		t.Fatalf("Detach(): %v", err)
+	}
+	if m.refs != 1 || m.data == nil {
+		t.Fatalf("%d references after Detach(), want 1 and the file still mapped", m.refs)
+	}
+	err = j.Detach()
+	if err == nil {
+		t.Fatalf("Detach() of a detached reader succeeded")
+	}
+
+	entries := read_all(t, c)
+	if len(entries) != FIXTURE_ENTRIES {
+		t.Fatalf("The clone read %d entries, want %d", len(entries), FIXTURE_ENTRIES)
+	}
+
+	err = c.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.refs != 0 {
+		t.Fatalf("%d references after closing the clone, want 0", m.refs)
+	}
+}
@@ -0,0 +1,351 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The priority of entries without a PRIORITY field, LOG_INFO
+const PRIORITY_DEFAULT = 6
+
+// The least important syslog priority, LOG_DEBUG
+const PRIORITY_DEBUG = 7
+
+/*
+ * Only return entries that have the field set to the given value, like
+ * journalctl FIELD=VALUE.
+ *
+ * Matches on the same field are ORed, matches on different fields are
+ * ANDed. Entries are found through the entry arrays of the matching data
+ * objects, so non-matching entries are skipped without being read.
+ *
+ * AddDisjunction() starts a new group of matches, entries matching any
+ * of the groups are returned.
+ */
+func (j *SdjournalReader) AddMatch(field, value string) error {
+	if field == "" || strings.Contains(field, "=") {
+		return fmt.Errorf("Invalid field name %q", field)
+	}
+	if j.matches == nil {
+		j.matches = make(map[string][]string)
+	}
+	j.matches[field] = append(j.matches[field], value)
+	j._filtersChanged()
+	return nil
+}
+
+/*
+ * Closes the current group of matches, further ones go into a new group
+ * that is ORed with the previous ones, like "+" between matches on the
+ * journalctl command line. Does nothing if the current group is empty.
+ *
+ * SetMaxPriority() applies to all the groups.
+ */
+func (j *SdjournalReader) AddDisjunction() {
+	if len(j.matches) == 0 {
+		return
+	}
+	j.disjunctions = append(j.disjunctions, j.matches)
+	j.matches = nil
+	j._filtersChanged()
+}
+
+func clone_matches(matches map[string][]string) map[string][]string {
+	if matches == nil {
+		return nil
+	}
+	c := make(map[string][]string, len(matches))
+	for field, values := range matches {
+		c[field] = slices.Clone(values)
+	}
+	return c
+}
+
+/*
+ * Only return entries with a syslog priority of prio or more important,
+ * i.e. a PRIORITY value numerically not above prio. Entries without a
+ * PRIORITY field count as PRIORITY_DEFAULT.
+ *
+ * Below PRIORITY_DEFAULT this works like matching PRIORITY against each
+ * accepted level, so skipped entries are never read. Otherwise the
+ * entries without PRIORITY qualify too and each entry is checked. From
+ * PRIORITY_DEBUG on all entries pass, whatever their PRIORITY holds.
+ *
+ * A PRIORITY that isn't a number fails the check, except in lenient
+ * mode, see SetLenient(), where such entries pass and every entry is
+ * checked at all levels.
+ */
+func (j *SdjournalReader) SetMaxPriority(prio int) {
+	j.max_priority = prio
+	j.has_max_priority = true
+	j._filtersChanged()
+}
+
+/*
+ * Whether SetMaxPriority() is applied as a match on the accepted levels.
+ * In lenient mode each entry is checked instead, so PRIORITY values that
+ * aren't numbers pass.
+ */
+func (j *SdjournalReader) _priorityAsMatch() bool {
+	return j.has_max_priority && j.max_priority < PRIORITY_DEFAULT && !j.lenient
+}
+
+// Whether SetMaxPriority() is applied by checking each entry
+func (j *SdjournalReader) _priorityPerEntry() bool {
+	return j.has_max_priority && !j._priorityAsMatch() && j.max_priority < PRIORITY_DEBUG
+}
+
+func (j *SdjournalReader) _hasMatches() bool {
+	return len(j.matches) > 0 || len(j.disjunctions) > 0 || j._priorityAsMatch()
+}
+
+/*
+ * Whether the entry at the given offset passes SetMaxPriority(). In
+ * lenient mode an entry whose data objects can't be read is skipped and
+ * the error recorded, like the fields Next() can't read.
+ */
+func (j *SdjournalReader) _priorityMatches(offset uint64) (bool, error) {
+	offsetdata, err := j._loadDataOffsetsFromEntry(offset)
+	if err != nil {
+		return false, err
+	}
+
+	for _, data_offset := range offsetdata {
+		name, err := j._loadDataFieldName(data_offset)
+		if err != nil {
+			return false, j._skipField(offset, err)
+		}
+		if string(name) != "PRIORITY" {
+			continue
+		}
+
+		buf, err := j._loadData(data_offset)
+		if err != nil {
+			return false, j._skipField(offset, err)
+		}
+		prio, err := strconv.Atoi(string(bytes.TrimPrefix(buf, []byte("PRIORITY="))))
+		if err != nil {
+			// Not a syslog level, journalctl doesn't match it either
+			return j.lenient, nil
+		}
+		return prio <= j.max_priority, nil
+	}
+	return PRIORITY_DEFAULT <= j.max_priority, nil
+}
+
+// Resolves a group of values of one field to their data objects
+func (j *SdjournalReader) _matchGroup(field string, values []string) ([]uint64, error) {
+	var group []uint64
+	for _, value := range values {
+		offset, found, err := j.lookupData([]byte(field + "=" + value))
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			group = append(group, offset)
+		}
+	}
+	return group, nil
+}
+
+/*
+ * Returns the offsets of the data objects for a group of matches, one
+ * group of offsets per field. Values that don't occur in the file are
+ * left out, a group with no data objects can't match anything.
+ */
+func (j *SdjournalReader) _matchGroups(matches map[string][]string) ([][]uint64, error) {
+	fields := make([]string, 0, len(matches))
+	for field := range matches {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	groups := make([][]uint64, 0, len(fields)+1)
+	for _, field := range fields {
+		group, err := j._matchGroup(field, matches[field])
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if j._priorityAsMatch() {
+		var levels []string
+		for prio := 0; prio <= j.max_priority; prio++ {
+			levels = append(levels, strconv.Itoa(prio))
+		}
+		group, err := j._matchGroup("PRIORITY", levels)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+/*
+ * Returns the first entry at or after min that references the data
+ * object, 0 if there is none.
+ *
+ * The entries of a data object are its entry_offset followed by its
+ * entry array chain, all in file order, so arrays are skipped by their
+ * last item and searched by bisection.
+ */
+func (j *SdjournalReader) _dataEntryFrom(data_offset uint64, min uint64) (uint64, error) {
+	d, _, err := j._loadDataObject(data_offset)
+	if err != nil {
+		return 0, err
+	}
+
+	if d.entry_offset >= min {
+		return d.entry_offset, nil
+	}
+
+	array_offset := d.entry_array_offset
+	for array_offset != 0 {
+		h, items, err := j._entryArrayAt(array_offset)
+		if err != nil {
+			return 0, err
+		}
+
+		n := j._entryArrayUsed(h, items)
+		if n > 0 && j._entryArrayItem(items, n-1) >= min {
+			i := sort.Search(int(n), func(i int) bool {
+				return j._entryArrayItem(items, uint64(i)) >= min
+			})
+			return j._entryArrayItem(items, uint64(i)), nil
+		}
+		array_offset, err = _nextEntryArray(array_offset, h)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+/*
+ * Returns the data objects of the groups of matches of each disjunction,
+ * see _matchGroups(). They are looked up in the hash table once and kept
+ * until the filters change, or the file grows and the values may have
+ * been added.
+ */
+func (j *SdjournalReader) _matchTerms() ([][][]uint64, error) {
+	if j.match_terms != nil {
+		return j.match_terms, nil
+	}
+
+	terms := j.disjunctions
+	if len(j.matches) > 0 || len(terms) == 0 {
+		// With only a priority filter the current group is empty
+		terms = append(terms[:len(terms):len(terms)], j.matches)
+	}
+
+	r := make([][][]uint64, 0, len(terms))
+	for _, matches := range terms {
+		groups, err := j._matchGroups(matches)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, groups)
+	}
+	j.match_terms = r
+	return r, nil
+}
+
+/*
+ * Returns the first entry at or after min passing the matches, 0 if
+ * there is none: the earliest one matching any of the disjunctions.
+ */
+func (j *SdjournalReader) _nextMatch(min uint64) (uint64, error) {
+	terms, err := j._matchTerms()
+	if err != nil {
+		return 0, err
+	}
+
+	best := uint64(0)
+	for _, groups := range terms {
+		offset, err := j._nextMatchGroups(groups, min)
+		if err != nil {
+			return 0, err
+		}
+		if offset != 0 && (best == 0 || offset < best) {
+			best = offset
+		}
+	}
+	return best, nil
+}
+
+/*
+ * Returns the first entry at or after min referencing one of the data
+ * objects of each group, 0 if there is none.
+ *
+ * Each group proposes its first matching entry from min on. Whenever one
+ * is further ahead, min moves there, until all groups agree.
+ */
+func (j *SdjournalReader) _nextMatchGroups(groups [][]uint64, min uint64) (uint64, error) {
+	for {
+		agreed := true
+
+		for _, group := range groups {
+			best := uint64(0)
+			for _, data_offset := range group {
+				offset, err := j._dataEntryFrom(data_offset, min)
+				if err != nil {
+					return 0, err
+				}
+				if offset != 0 && (best == 0 || offset < best) {
+					best = offset
+				}
+			}
+
+			if best == 0 {
+				return 0, nil
+			}
+			if best > min {
+				min = best
+				agreed = false
+			}
+		}
+
+		if agreed {
+			return min, nil
+		}
+	}
+}
+
+/*
+ * Positions the iterator so that the next entry returned is the one at
+ * the given offset.
+ */
+func (j *SdjournalReader) _seekEntry(offset uint64) error {
+	target, err := j._loadEntryObject(offset)
+	if err != nil {
+		return err
+	}
+
+	err = j._seekFirst(func(h *EntryObject) bool {
+		return h.seqnum < target.seqnum
+	})
+	if err != nil {
+		return err
+	}
+
+	// Seeking relies on seqnums growing in file order
+	if j.entryarray == nil || j.array_iterator >= j._entryArrayCapacity(j.entryarray) ||
+		j._entryArrayItem(j.entryarray_items, j.array_iterator) != offset {
+		return fmt.Errorf("Entry at %d can't be located by its seqnum", offset)
+	}
+	return nil
+}
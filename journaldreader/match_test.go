@@ -0,0 +1,50 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"testing"
+)
+
+/*
+ * Matches are looked up in the hash tables of each file, with its own
+ * hash function: Jenkins in regular.journal, SipHash keyed with the
+ * file_id in compact.journal. The same matches must hit in both.
+ */
+func TestAddMatchKeyedAndNotKeyed(t *testing.T) {
+	tests := []struct {
+		field   string
+		value   string
+		entries int
+	}{
+		{"MESSAGE", "message number 7", 1},
+		{"SYSLOG_IDENTIFIER", "fxbig", 1},
+		{"SYSLOG_IDENTIFIER", "fxtest", 30},
+		{"MESSAGE", "no such message", 0},
+	}
+
+	for _, name := range []string{"regular.journal", "compact.journal"} {
+		for _, test := range tests {
+			j := open_fixture(t, name)
+			err := j.AddMatch(test.field, test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries := read_all(t, j)
+			if len(entries) != test.entries {
+				t.Fatalf("%s: %s=%s matched %d entries, want %d", name, test.field, test.value, len(entries), test.entries)
+			}
+			for _, entry := range entries {
+				if entry.Fields[test.field] != test.value {
+					t.Fatalf("%s: %s=%s matched an entry with %q", name, test.field, test.value, entry.Fields[test.field])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,276 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+)
+
+type mergeSource struct {
+	filename string
+	reader   *SdjournalReader
+	head     *Entry
+}
+
+// A min-heap of sources ordered by their next entry
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	a := h[i].head
+	b := h[j].head
+	id_diff := compare_seqnum_id(a.SeqnumID, b.SeqnumID)
+	if id_diff != 0 {
+		return id_diff < 0
+	}
+	return a.Seqnum < b.Seqnum
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x any) { *h = append(*h, x.(*mergeSource)) }
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+/*
+ * Reads several journal files as a single stream of entries.
+ *
+ * The files are merged entry by entry, always returning the entry with
+ * the lowest (seqnum_id, seqnum) next. Files are closed as soon as they
+ * are exhausted.
+ *
+ * A file that fails to open or read is dropped from the merge and the
+ * others continue, the failures are available through Errors().
+ *
+ * The files are only read from on the first Next(), so that matches can
+ * be added before.
+ */
+type MergedReader struct {
+	sources mergeHeap
+	errors  map[string]error
+
+	// Opened files whose first entry hasn't been read yet
+	pending []*mergeSource
+	started bool
+
+	// Set the source file and cursor of the returned entries
+	annotate bool
+}
+
+/*
+ * Opens all the files for merging, typically the output of
+ * OpenDirectory() or SortJournalFiles().
+ *
+ * An error is only returned when none of the files could be opened.
+ */
+func NewMergedReader(files []string) (*MergedReader, error) {
+	return NewMergedReaderAfter(files, nil)
+}
+
+/*
+ * Like NewMergedReader() but resumes each file after the entry of its
+ * cursor in cursors, by file name, as saved from the SourceCursor of the
+ * last entry returned from it, see SetSourceAnnotation(). Files without
+ * a cursor are read from the start.
+ *
+ * A file whose cursor can't be located is dropped, its error is in
+ * Errors().
+ */
+func NewMergedReaderAfter(files []string, cursors map[string]string) (*MergedReader, error) {
+	m := &MergedReader{errors: make(map[string]error)}
+
+	for _, filename := range files {
+		j := &SdjournalReader{}
+		err := j.Open(filename)
+		if err == nil {
+			c, ok := cursors[filename]
+			if ok {
+				err = _seekAfterCursor(j, c)
+			}
+		}
+		if err != nil {
+			j.Close()
+			m.errors[filename] = err
+			continue
+		}
+		m.pending = append(m.pending, &mergeSource{filename: filename, reader: j})
+	}
+
+	if len(m.pending) == 0 && len(m.errors) > 0 {
+		for filename, err := range m.errors {
+			return nil, fmt.Errorf("No journal file could be read, %s: %w", filename, err)
+		}
+	}
+
+	return m, nil
+}
+
+/*
+ * Positions the reader after the entry of the cursor, or at the first
+ * entry after it if that entry is gone, like journalctl --after-cursor.
+ */
+func _seekAfterCursor(j *SdjournalReader, s string) error {
+	c, err := parse_cursor(s)
+	if err != nil {
+		return err
+	}
+	err = j.SeekCursor(s)
+	if err != nil {
+		return err
+	}
+
+	entry, ok, err := j.Peek()
+	if err != nil || !ok {
+		return err
+	}
+	if c.has_seqnum && entry.Seqnum == c.seqnum && c.has_seqnum_id && entry.SeqnumID == c.seqnum_id {
+		_, _, err = j.NextEntry()
+	}
+	return err
+}
+
+// Reads the next entry of the source and puts it back in the heap
+func (m *MergedReader) _advance(s *mergeSource) {
+	entry, ok, err := s.reader.NextEntry()
+	if err != nil {
+		m.errors[s.filename] = err
+	}
+	if err != nil || !ok {
+		s.reader.Close()
+		return
+	}
+	s.head = entry
+	heap.Push(&m.sources, s)
+}
+
+/*
+ * Returns the next entry across all files
+ *
+ * The boolean is false once every file has been exhausted.
+ */
+func (m *MergedReader) Next() (*Entry, bool, error) {
+	if !m.started {
+		for _, s := range m.pending {
+			m._advance(s)
+		}
+		m.pending = nil
+		m.started = true
+	}
+	if len(m.sources) == 0 {
+		return nil, false, nil
+	}
+
+	s := heap.Pop(&m.sources).(*mergeSource)
+	entry := s.head
+	s.head = nil
+
+	if m.annotate {
+		// The source hasn't moved past the entry yet
+		cursor, err := s.reader.Cursor()
+		if err != nil {
+			// The entry is still good, it goes out without annotation
+			m.errors[s.filename] = fmt.Errorf("Entry %d can't be annotated: %w", entry.Seqnum, err)
+		} else {
+			entry.SourceFile = s.filename
+			entry.SourceCursor = cursor
+		}
+	}
+	m._advance(s)
+
+	return entry, true, nil
+}
+
+/*
+ * Adds the match to every file, see SdjournalReader.AddMatch(). Each file
+ * looks the value up in its own hash table, with its own hash function
+ * and key, so files written before and after journald switched to keyed
+ * hashes can be merged.
+ *
+ * Matches have to be added before the first Next().
+ */
+func (m *MergedReader) AddMatch(field, value string) error {
+	if m.started {
+		return fmt.Errorf("Matches must be added before reading")
+	}
+	for _, s := range m.pending {
+		err := s.reader.AddMatch(field, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Starts a new group of matches in every file, see
+ * SdjournalReader.AddDisjunction(). Does nothing once reading started.
+ */
+func (m *MergedReader) AddDisjunction() {
+	for _, s := range m.pending {
+		s.reader.AddDisjunction()
+	}
+}
+
+/*
+ * Makes Next() set SourceFile and SourceCursor on the entries it returns,
+ * so a consumer can save the position reached in each file and resume
+ * with NewMergedReaderAfter(). Off by default, getting the cursor costs a
+ * little for every entry.
+ *
+ * An entry whose cursor can't be read is returned without annotation,
+ * the failure is recorded for its file in Errors() and the file is
+ * read on.
+ */
+func (m *MergedReader) SetSourceAnnotation(enable bool) {
+	m.annotate = enable
+}
+
+/*
+ * Like Next() but stops with the context error once ctx is cancelled.
+ */
+func (m *MergedReader) NextContext(ctx context.Context) (*Entry, bool, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, false, err
+	}
+	return m.Next()
+}
+
+/*
+ * Returns the files that failed to open or read, with their error, and
+ * those with entries that couldn't be annotated, see
+ * SetSourceAnnotation().
+ */
+func (m *MergedReader) Errors() map[string]error {
+	return m.errors
+}
+
+/*
+ * Closes the files that haven't been exhausted yet.
+ */
+func (m *MergedReader) Close() error {
+	var first error
+	for _, s := range append(m.pending, m.sources...) {
+		err := s.reader.Close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	m.sources = nil
+	m.pending = nil
+	return first
+}
@@ -0,0 +1,236 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func read_merged(t *testing.T, m *MergedReader) []*Entry {
+	t.Helper()
+
+	var r []*Entry
+	for {
+		entry, ok, err := m.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if !ok {
+			return r
+		}
+		r = append(r, entry)
+	}
+}
+
+func TestMergedReaderSourceAnnotation(t *testing.T) {
+	files := []string{fixture("regular.journal"), fixture("compact.journal")}
+
+	m, err := NewMergedReader(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.SetSourceAnnotation(true)
+
+	entries := read_merged(t, m)
+	if len(entries) != 2*FIXTURE_ENTRIES {
+		t.Fatalf("Got %d entries, want %d", len(entries), 2*FIXTURE_ENTRIES)
+	}
+
+	readers := make(map[string]*SdjournalReader)
+	for _, file := range files {
+		j := &SdjournalReader{}
+		err := j.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+		readers[file] = j
+	}
+
+	for i, entry := range entries {
+		j, ok := readers[entry.SourceFile]
+		if !ok {
+			t.Fatalf("Entry %d has source file %q", i, entry.SourceFile)
+		}
+
+		// The cursor leads back to the entry in its own file
+		err := j.SeekCursor(entry.SourceCursor)
+		if err != nil {
+			t.Fatalf("Entry %d: SeekCursor(%q): %v", i, entry.SourceCursor, err)
+		}
+		e, ok, err := j.NextEntry()
+		if err != nil || !ok {
+			t.Fatalf("Entry %d: NextEntry after SeekCursor: %v, %v", i, ok, err)
+		}
+		if e.SeqnumID != entry.SeqnumID || e.Seqnum != entry.Seqnum || e.Fields["MESSAGE"] != entry.Fields["MESSAGE"] {
+			t.Fatalf("Entry %d: cursor %q leads to seqnum %d, want %d", i, entry.SourceCursor, e.Seqnum, entry.Seqnum)
+		}
+	}
+}
+
+func TestMergedReaderWithoutAnnotation(t *testing.T) {
+	m, err := NewMergedReader([]string{fixture("regular.journal"), fixture("compact.journal")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for _, entry := range read_merged(t, m) {
+		if entry.SourceFile != "" || entry.SourceCursor != "" {
+			t.Fatalf("Entry %d is annotated with %q, %q", entry.Seqnum, entry.SourceFile, entry.SourceCursor)
+		}
+	}
+}
+
+func TestMergedReaderResume(t *testing.T) {
+	files := []string{fixture("regular.journal"), fixture("compact.journal")}
+
+	m, err := NewMergedReader(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetSourceAnnotation(true)
+	all := read_merged(t, m)
+	m.Close()
+
+	// Stop in the middle of the second file, the first one is done
+	stop := FIXTURE_ENTRIES + 10
+	cursors := make(map[string]string)
+	for _, entry := range all[:stop] {
+		cursors[entry.SourceFile] = entry.SourceCursor
+	}
+
+	m, err = NewMergedReaderAfter(files, cursors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.SetSourceAnnotation(true)
+
+	rest := read_merged(t, m)
+	if len(rest) != len(all)-stop {
+		t.Fatalf("Resumed with %d entries, want %d", len(rest), len(all)-stop)
+	}
+	for i, entry := range rest {
+		want := all[stop+i]
+		if entry.SourceCursor != want.SourceCursor || entry.SourceFile != want.SourceFile {
+			t.Fatalf("Resumed entry %d is %s in %s, want %s in %s", i, entry.SourceCursor, entry.SourceFile, want.SourceCursor, want.SourceFile)
+		}
+	}
+}
+
+// A directory with a keyed and a non-keyed journal, as after the upgrade to systemd 246
+func mixed_hash_directory(t *testing.T) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range []string{"regular.journal", "compact.journal"} {
+		data, err := os.ReadFile(fixture(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), data, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := OpenDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("OpenDirectory() found %v", files)
+	}
+	return files
+}
+
+func TestMergedReaderAddMatch(t *testing.T) {
+	files := mixed_hash_directory(t)
+
+	m, err := NewMergedReader(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.SetSourceAnnotation(true)
+
+	err = m.AddMatch("MESSAGE", "message number 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddDisjunction()
+	err = m.AddMatch("SYSLOG_IDENTIFIER", "fxbig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	per_file := make(map[string]int)
+	for _, entry := range read_merged(t, m) {
+		if entry.Fields["MESSAGE"] != "message number 7" && entry.Fields["SYSLOG_IDENTIFIER"] != "fxbig" {
+			t.Fatalf("Entry %d of %s doesn't match", entry.Seqnum, entry.SourceFile)
+		}
+		per_file[entry.SourceFile]++
+	}
+	for _, filename := range files {
+		if per_file[filename] != 2 {
+			t.Fatalf("%d entries matched in %s, want 2", per_file[filename], filename)
+		}
+	}
+	if len(m.Errors()) != 0 {
+		t.Fatalf("Errors() = %v", m.Errors())
+	}
+
+	err = m.AddMatch("_UID", "0")
+	if err == nil {
+		t.Fatalf("AddMatch() after reading succeeded")
+	}
+}
+
+// A failing Cursor() doesn't lose the entry nor the rest of the file
+func TestMergedReaderAnnotationFailure(t *testing.T) {
+	filename := fixture("regular.journal")
+	m, err := NewMergedReader([]string{filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.SetSourceAnnotation(true)
+
+	_, ok, err := m.Next()
+	if err != nil || !ok {
+		t.Fatalf("Next() = %v, %v", ok, err)
+	}
+
+	// The reader forgets the entry at the head of the merge
+	m.sources[0].reader.last_entry_offset = 0
+
+	entry, ok, err := m.Next()
+	if err != nil || !ok {
+		t.Fatalf("Next() = %v, %v, want the entry without annotation", ok, err)
+	}
+	if entry.SourceFile != "" || entry.SourceCursor != "" {
+		t.Fatalf("Entry annotated with %q, %q", entry.SourceFile, entry.SourceCursor)
+	}
+	if m.Errors()[filename] == nil {
+		t.Fatalf("Errors() = %v, want the failure for %s", m.Errors(), filename)
+	}
+
+	rest := read_merged(t, m)
+	if len(rest) != FIXTURE_ENTRIES-2 {
+		t.Fatalf("Read %d more entries, want %d", len(rest), FIXTURE_ENTRIES-2)
+	}
+	for _, entry := range rest {
+		if entry.SourceFile != filename || entry.SourceCursor == "" {
+			t.Fatalf("Entry %d isn't annotated", entry.Seqnum)
+		}
+	}
+}
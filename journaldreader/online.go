@@ -0,0 +1,55 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+/*
+ * Like Open() but for a file journald still writes to, e.g. the current
+ * system.journal, whose header is in the STATE_ONLINE state.
+ *
+ * Whenever the iteration reaches the end, the file is checked once for
+ * growth and the header and current entry array are read again before
+ * reporting the end, so entries appended while reading are returned too.
+ * Unlike Follow() this doesn't wait for new entries or handle rotation.
+ *
+ * Clones of such a reader share its mapping and don't look for growth.
+ */
+func (j *SdjournalReader) OpenOnline(journalfile string) error {
+	err := j.Open(journalfile)
+	if err != nil {
+		return err
+	}
+	j.online = true
+	return nil
+}
+
+/*
+ * Reports whether journald appended objects past the end of the mapping,
+ * going by the tail_object_offset it updates in the mapped header. The
+ * header copy may be stale, the mapped bytes are read instead.
+ */
+func (j *SdjournalReader) _onlineGrown() bool {
+	if j.mapping == nil {
+		return false
+	}
+	tail := binary.LittleEndian.Uint64(j.data[unsafe.Offsetof(j.header.tail_object_offset):])
+	return tail > j.size || j.size-tail < OBJECT_HEADER_SIZE
+}
+
+// Picks up what journald appended to the file since the last look
+func (j *SdjournalReader) _onlineRefresh() error {
+	if j.mapping == nil {
+		// Decompressed into memory, can't change
+		return nil
+	}
+	return j._followGrow()
+}
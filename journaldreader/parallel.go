@@ -0,0 +1,152 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Number of entries handed to a worker of ReadAllParallel() at a time
+const PARALLEL_CHUNK_ENTRIES = 1024
+
+// Entries start to end (excluded) of an entry array
+type entryRange struct {
+	items []byte
+	start uint64
+	end   uint64
+}
+
+/*
+ * Cuts the entry array chain into ranges of up to PARALLEL_CHUNK_ENTRIES
+ * entries. Later arrays are much larger than the first ones, splitting
+ * them keeps the workers busy until the end.
+ */
+func (j *SdjournalReader) _entryRanges() ([]entryRange, error) {
+	var r []entryRange
+
+	array_offset := j.header.entry_array_offset
+	for array_offset != 0 {
+		h, items, err := j._entryArrayAt(array_offset)
+		if err != nil {
+			return nil, err
+		}
+
+		used := j._entryArrayUsed(h, items)
+		for start := uint64(0); start < used; start += PARALLEL_CHUNK_ENTRIES {
+			r = append(r, entryRange{items, start, min(start+PARALLEL_CHUNK_ENTRIES, used)})
+		}
+
+		array_offset, err = _nextEntryArray(array_offset, h)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+/*
+ * Calls fn with every entry of the file, read by workers goroutines at
+ * once, each with its own Clone() and decompressor. This pays off when
+ * decompressing dominates, e.g. for large ZSTD compressed journals.
+ * workers <= 0 uses GOMAXPROCS.
+ *
+ * Entries are NOT passed in file order and fn is called concurrently, it
+ * must be safe for that. Sort by Seqnum afterwards if the order matters.
+ * Like EntryAt() this reads all the entries, matches and the window of
+ * OpenWindow() don't apply, and the iterator doesn't move.
+ *
+ * The first error, from reading or from fn, stops the workers once their
+ * current entry is done and is returned. Errors() and Stats() of the
+ * reader include those of the workers.
+ */
+func (j *SdjournalReader) ReadAllParallel(workers int, fn func(*Entry) error) error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	ranges, err := j._entryRanges()
+	if err != nil {
+		return err
+	}
+	if len(ranges) < workers {
+		workers = max(len(ranges), 1)
+	}
+
+	clones := make([]*SdjournalReader, 0, workers)
+	defer func() {
+		for _, c := range clones {
+			j.errors = append(j.errors, c.errors...)
+			j.stats.add(c.stats)
+			c.Close()
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		c, err := j.Clone()
+		if err != nil {
+			return err
+		}
+		clones = append(clones, c)
+	}
+
+	var mu sync.Mutex
+	var first error
+	stop := make(chan struct{})
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+			close(stop)
+		}
+	}
+
+	jobs := make(chan entryRange)
+	var wg sync.WaitGroup
+	for _, c := range clones {
+		wg.Add(1)
+		go func(c *SdjournalReader) {
+			defer wg.Done()
+			for r := range jobs {
+				for i := r.start; i < r.end; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+
+					entry, err := c._readEntry(c._entryArrayItem(r.items, i))
+					if err == nil {
+						err = fn(entry)
+					}
+					if err != nil {
+						fail(err)
+						return
+					}
+				}
+			}
+		}(c)
+	}
+
+feed:
+	for _, r := range ranges {
+		select {
+		case jobs <- r:
+		case <-stop:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return first
+}
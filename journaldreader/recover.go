@@ -0,0 +1,74 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"fmt"
+)
+
+/*
+ * Reads every entry object found in the file, in file order, without
+ * relying on the entry arrays. This is for files whose entry array chain
+ * is broken, like the .journal~ files journald sets aside as corrupted.
+ *
+ * The file is scanned object by object from the end of the header to the
+ * end of the file. Where there is no valid object header the scan moves
+ * on 8 bytes at a time until it finds one. Entries are read leniently
+ * whatever SetLenient() says: unreadable fields are skipped, entries
+ * that can't be read at all are left out and the reasons are recorded in
+ * Errors().
+ *
+ * Matches and filters don't apply and the iterator doesn't move. Anything
+ * that looks like an entry is returned, including entries journald may
+ * not have finished writing.
+ */
+func (j *SdjournalReader) RecoverEntries() ([]*Entry, error) {
+	if !j.opened {
+		return nil, fmt.Errorf("This object hasn't been opened")
+	}
+
+	lenient := j.lenient
+	j.lenient = true
+	defer func() {
+		j.lenient = lenient
+	}()
+
+	offset := j.header.header_size
+	if offset < HEADER_SIZE || offset&7 != 0 {
+		offset = HEADER_SIZE
+	}
+
+	var r []*Entry
+	for offset < j.size && j.size-offset >= OBJECT_HEADER_SIZE {
+		buf, err := j._slice(offset, OBJECT_HEADER_SIZE)
+		if err != nil {
+			return r, err
+		}
+		h := decode_object_header(buf)
+
+		if h.type_ < OBJECT_DATA || h.type_ > OBJECT_TAG || j._checkObjectSize(offset, h, OBJECT_HEADER_SIZE) != nil {
+			offset += 8
+			continue
+		}
+
+		if h.type_ == OBJECT_ENTRY {
+			entry, err := j._readEntry(offset)
+			if err != nil {
+				// Its size can't be trusted either
+				j.errors = append(j.errors, fmt.Errorf("Entry at %d: %w", offset, err))
+				offset += 8
+				continue
+			}
+			if len(entry.Fields) > 0 {
+				r = append(r, entry)
+			}
+		}
+		offset += (h.size + 7) &^ 7
+	}
+	return r, nil
+}
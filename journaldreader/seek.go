@@ -0,0 +1,330 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+// Number of used item slots in the array, only the last array has unused ones
+func (j *SdjournalReader) _entryArrayUsed(h *EntryArrayObject, items []byte) uint64 {
+	n := j._entryArrayCapacity(h)
+
+	return uint64(sort.Search(int(n), func(i int) bool {
+		return j._entryArrayItem(items, uint64(i)) == 0
+	}))
+}
+
+func (j *SdjournalReader) _setPosition(array_offset uint64, h *EntryArrayObject, items []byte, i uint64) {
+	j.entry_array_offset = array_offset
+	j.entryarray = h
+	j.entryarray_items = items
+	j.array_iterator = i
+}
+
+/*
+ * Positions the iterator so that the next entry returned is the first
+ * one for which before() is false, or at the end if there is none.
+ *
+ * before() must be monotonic over the file, e.g. comparing seqnums, so
+ * whole arrays can be skipped by looking at their last entry and the
+ * position within an array is found by binary search.
+ */
+func (j *SdjournalReader) _seekFirst(before func(h *EntryObject) bool) error {
+	array_offset := j.header.entry_array_offset
+	if array_offset == 0 {
+		// No entries, the iterator is at the end already
+		return nil
+	}
+
+	for {
+		h, items, err := j._entryArrayAt(array_offset)
+		if err != nil {
+			return err
+		}
+
+		n := j._entryArrayUsed(h, items)
+
+		target := n
+		if n > 0 {
+			last, err := j._loadEntryObject(j._entryArrayItem(items, n-1))
+			if err != nil {
+				return err
+			}
+			if !before(last) {
+				var search_err error
+				target = uint64(sort.Search(int(n), func(i int) bool {
+					if search_err != nil {
+						return true
+					}
+					e, err := j._loadEntryObject(j._entryArrayItem(items, uint64(i)))
+					if err != nil {
+						search_err = err
+						return true
+					}
+					return !before(e)
+				}))
+				if search_err != nil {
+					return search_err
+				}
+			}
+		}
+
+		if target < n || h.next_entry_array_offset == 0 {
+			j._setPosition(array_offset, h, items, target)
+			return nil
+		}
+		array_offset, err = _nextEntryArray(array_offset, h)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+/*
+ * Positions the iterator so that the next entry returned is the first
+ * one with a seqnum of at least the given one, or at the end if there is
+ * none. Unlike realtime timestamps seqnums never go backwards, which
+ * makes them the safe way to resume reading a file.
+ *
+ * Seqnums are only comparable between files sharing a seqnum id, see
+ * SeqnumID().
+ */
+func (j *SdjournalReader) SeekSeqnum(seqnum uint64) error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+
+	j.last_entry_offset = 0
+	j.peeked = nil
+	return j._seekFirst(func(h *EntryObject) bool {
+		return h.seqnum < seqnum
+	})
+}
+
+/*
+ * Positions the iterator so that the next entry returned is the first
+ * one of the given boot with a monotonic timestamp of at least usec. If
+ * all entries of the boot are earlier, Next() continues after the last
+ * of them.
+ *
+ * The entries of a boot are those referencing its _BOOT_ID data object,
+ * and their monotonic timestamps grow, so they are searched like
+ * _seekFirst() does without looking at other boots.
+ */
+func (j *SdjournalReader) SeekMonotonic(bootID [16]byte, usec uint64) error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+
+	data_offset, found, err := j.lookupData([]byte("_BOOT_ID=" + ID128String(bootID)))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("Boot %s is not in this file", ID128String(bootID))
+	}
+
+	offset, last, err := j._dataEntryFirst(data_offset, func(h *EntryObject) bool {
+		return h.monotonic < usec
+	})
+	if err != nil {
+		return err
+	}
+	if last == 0 {
+		return fmt.Errorf("Boot %s has no entries in this file", ID128String(bootID))
+	}
+
+	j.last_entry_offset = 0
+	j.peeked = nil
+	if offset != 0 {
+		return j._seekEntry(offset)
+	}
+
+	err = j._seekEntry(last)
+	if err != nil {
+		return err
+	}
+	_, err = j._next_entry_offset()
+	return err
+}
+
+/*
+ * Returns the first entry referencing the data object for which before()
+ * is false, 0 if there is none, along with the last entry that was
+ * looked at.
+ *
+ * before() must be monotonic over the entries of the data object.
+ */
+func (j *SdjournalReader) _dataEntryFirst(data_offset uint64, before func(h *EntryObject) bool) (uint64, uint64, error) {
+	d, _, err := j._loadDataObject(data_offset)
+	if err != nil {
+		return 0, 0, err
+	}
+	if d.entry_offset == 0 {
+		return 0, 0, nil
+	}
+
+	last := d.entry_offset
+	e, err := j._loadEntryObject(last)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !before(e) {
+		return last, last, nil
+	}
+
+	array_offset := d.entry_array_offset
+	for array_offset != 0 {
+		h, items, err := j._entryArrayAt(array_offset)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		n := j._entryArrayUsed(h, items)
+		if n == 0 {
+			break
+		}
+
+		last = j._entryArrayItem(items, n-1)
+		e, err := j._loadEntryObject(last)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !before(e) {
+			var search_err error
+			i := sort.Search(int(n), func(i int) bool {
+				if search_err != nil {
+					return true
+				}
+				e, err := j._loadEntryObject(j._entryArrayItem(items, uint64(i)))
+				if err != nil {
+					search_err = err
+					return true
+				}
+				return !before(e)
+			})
+			if search_err != nil {
+				return 0, 0, search_err
+			}
+			offset := j._entryArrayItem(items, uint64(i))
+			return offset, offset, nil
+		}
+
+		array_offset, err = _nextEntryArray(array_offset, h)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return 0, last, nil
+}
+
+/*
+ * Returns the last array of the entry array chain and its number of used
+ * items from the header, which journald 252 and later keep up to date,
+ * without walking the chain. ok is false for older files or if the
+ * header doesn't point at a plausible tail.
+ */
+func (j *SdjournalReader) _tailEntryArray() (offset uint64, h *EntryArrayObject, items []byte, used uint64, ok bool) {
+	if !j._headerHas(unsafe.Offsetof(j.header.tail_entry_array_n_entries) + 4) {
+		return 0, nil, nil, 0, false
+	}
+	offset = uint64(j.header.tail_entry_array_offset)
+	if offset == 0 || j.header.entry_array_offset == 0 {
+		// Stale tail fields can't bring back entries the chain lacks
+		return 0, nil, nil, 0, false
+	}
+
+	h, items, err := j._entryArrayAt(offset)
+	if err != nil || h.next_entry_array_offset != 0 {
+		return 0, nil, nil, 0, false
+	}
+	// A file being written may have more entries than the header says
+	used = j._entryArrayUsed(h, items)
+	if used < uint64(j.header.tail_entry_array_n_entries) {
+		return 0, nil, nil, 0, false
+	}
+	return offset, h, items, used, true
+}
+
+/*
+ * Positions the iterator after the last entry, so that Next() only
+ * returns entries appended afterwards, e.g. with OpenOnline().
+ */
+func (j *SdjournalReader) SeekTail() error {
+	return j.SeekTailMinus(0)
+}
+
+/*
+ * Positions the iterator so that Next() returns the last n entries of
+ * the file, in order, or all of them if there are fewer. Filters are
+ * applied to those entries afterwards.
+ *
+ * Only the entry arrays are read to count the entries, the entries
+ * before the tail are never loaded. When the last array holds enough
+ * entries and the header records it, as from journald 252 on, nothing
+ * else is read.
+ */
+func (j *SdjournalReader) SeekTailMinus(n uint64) error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+
+	j.last_entry_offset = 0
+	j.peeked = nil
+
+	tail_offset, tail, tail_items, tail_used, ok := j._tailEntryArray()
+	if ok && n <= tail_used {
+		j._setPosition(tail_offset, tail, tail_items, tail_used-n)
+		return nil
+	}
+
+	type array struct {
+		offset uint64
+		h      *EntryArrayObject
+		items  []byte
+		used   uint64
+	}
+	var arrays []array
+	total := uint64(0)
+
+	array_offset := j.header.entry_array_offset
+	for array_offset != 0 {
+		h, items, err := j._entryArrayAt(array_offset)
+		if err != nil {
+			return err
+		}
+		used := j._entryArrayUsed(h, items)
+		arrays = append(arrays, array{array_offset, h, items, used})
+		total += used
+		array_offset, err = _nextEntryArray(array_offset, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(arrays) == 0 {
+		// No entries, the iterator is at the end already
+		return nil
+	}
+
+	skip := uint64(0)
+	if n < total {
+		skip = total - n
+	}
+	for i, a := range arrays {
+		if skip < a.used || i == len(arrays)-1 {
+			j._setPosition(a.offset, a.h, a.items, skip)
+			return nil
+		}
+		skip -= a.used
+	}
+	return nil
+}
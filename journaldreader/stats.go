@@ -0,0 +1,299 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+ * Data objects stored with one kind of compression. Bytes is the size of
+ * the stored payloads, Decompressed the size they decompress to, where
+ * known.
+ */
+type CompressionCount struct {
+	Objects      uint64
+	Bytes        uint64
+	Decompressed uint64
+}
+
+/*
+ * Data objects by compression, for the whole file or for one field.
+ *
+ * XZ payloads are counted but their decompressed size is unknown.
+ */
+type CompressionCounts struct {
+	Uncompressed CompressionCount
+	XZ           CompressionCount
+	LZ4          CompressionCount
+	ZSTD         CompressionCount
+}
+
+/*
+ * Returns the decompressed size of the LZ4 and ZSTD payloads divided by
+ * their stored size, 0 if there are none.
+ */
+func (c *CompressionCounts) Ratio() float64 {
+	stored := c.LZ4.Bytes + c.ZSTD.Bytes
+	if stored == 0 {
+		return 0
+	}
+	return float64(c.LZ4.Decompressed+c.ZSTD.Decompressed) / float64(stored)
+}
+
+// Returns the count for the compression of the given object flags
+func (c *CompressionCounts) count(flags uint8) *CompressionCount {
+	switch {
+	case flags&OBJECT_COMPRESSED_XZ != 0:
+		return &c.XZ
+	case flags&OBJECT_COMPRESSED_LZ4 != 0:
+		return &c.LZ4
+	case flags&OBJECT_COMPRESSED_ZSTD != 0:
+		return &c.ZSTD
+	}
+	return &c.Uncompressed
+}
+
+/*
+ * Data objects by compression as returned by CompressionStats(), for the
+ * whole file and by field name, to tell which fields are worth
+ * compressing.
+ */
+type CompressionSummary struct {
+	CompressionCounts
+	Fields map[string]CompressionCounts
+}
+
+/*
+ * Counts the data objects of the file and their payload sizes by
+ * compression, e.g. to see what Compress= in journald.conf achieves.
+ *
+ * The decompressed sizes are taken from the LZ4 size prefix and the
+ * ZSTD frame header. Only ZSTD frames that don't declare their size are
+ * decompressed, and the compressed payloads to read their field name.
+ */
+func (j *SdjournalReader) CompressionStats() (CompressionSummary, error) {
+	s := CompressionSummary{Fields: make(map[string]CompressionCounts)}
+
+	if !j.opened {
+		return s, fmt.Errorf("This object hasn't been opened")
+	}
+
+	err := j._walkObjects(func(offset uint64, h *ObjectHeader) error {
+		if h.type_ != OBJECT_DATA {
+			return nil
+		}
+		d, payload, err := j._loadDataObject(offset)
+		if err != nil {
+			return err
+		}
+		size := uint64(len(payload))
+		decompressed := size
+
+		switch {
+		case d.object.flags&OBJECT_COMPRESSED_XZ != 0:
+			decompressed = 0
+		case d.object.flags&OBJECT_COMPRESSED_LZ4 != 0:
+			if size < 8 {
+				return fmt.Errorf("LZ4 payload of data object at %d is too short", offset)
+			}
+			decompressed = binary.LittleEndian.Uint64(payload)
+		case d.object.flags&OBJECT_COMPRESSED_ZSTD != 0:
+			var frame zstd.Header
+			err = frame.Decode(payload)
+			if err != nil {
+				return fmt.Errorf("Data object at %d: %w", offset, err)
+			}
+			if !frame.HasFCS {
+				buf, err := j._loadData(offset)
+				if err != nil {
+					return err
+				}
+				frame.FrameContentSize = uint64(len(buf))
+			}
+			decompressed = frame.FrameContentSize
+		}
+
+		name, err := j._loadDataFieldName(offset)
+		if err != nil {
+			return err
+		}
+		field := s.Fields[string(name)]
+		for _, c := range []*CompressionCount{s.count(d.object.flags), field.count(d.object.flags)} {
+			c.Objects++
+			c.Bytes += size
+			c.Decompressed += decompressed
+		}
+		s.Fields[string(name)] = field
+		return nil
+	})
+	return s, err
+}
+
+/*
+ * Header summary returned by FileInfo(), all sizes in bytes.
+ *
+ * Used is where the tail object ends, the header size for files without
+ * objects. journald grows files ahead of time, so Size - Used is the
+ * space preallocated but not written yet. A file is Truncated when Used
+ * is beyond Size, i.e. objects the header accounts for are missing.
+ */
+type FileInfo struct {
+	HeaderSize       uint64
+	ArenaSize        uint64
+	TailObjectOffset uint64
+	Size             uint64
+	Used             uint64
+	Truncated        bool
+}
+
+/*
+ * Returns the sizes the header records for the file along with the size
+ * actually mapped, or read for compressed files, to tell preallocated
+ * space from truncation. It only reads the header and the tail object,
+ * see Verify() for a full check.
+ */
+func (j *SdjournalReader) FileInfo() (FileInfo, error) {
+	var info FileInfo
+
+	if !j.opened {
+		return info, fmt.Errorf("This object hasn't been opened")
+	}
+
+	info.HeaderSize = j.header.header_size
+	info.ArenaSize = j.header.arena_size
+	info.TailObjectOffset = j.header.tail_object_offset
+	info.Size = j.size
+	info.Used = j.header.header_size
+
+	tail := j.header.tail_object_offset
+	if tail != 0 {
+		buf, err := j._slice(tail, OBJECT_HEADER_SIZE)
+		if err != nil {
+			// At least the tail object's header is missing
+			info.Used = tail + OBJECT_HEADER_SIZE
+		} else {
+			h := decode_object_header(buf)
+			info.Used = tail + (h.size+7)&^7
+		}
+	}
+
+	info.Truncated = info.Used > info.Size
+	return info, nil
+}
+
+/*
+ * Counters of the work done by a reader, as returned by Stats(), since
+ * it was opened. Entries count the ones whose fields were read, also by
+ * exports, and data objects count every load, including the ones for
+ * lookups and matches.
+ *
+ * A high BytesDecompressed to BytesCompressed ratio points at payloads
+ * crafted to inflate, see SetMaxDecompressedSize(). Payloads served by
+ * the data cache count as CacheHits instead of being decompressed.
+ */
+type ReaderStats struct {
+	EntriesRead         uint64
+	DataObjectsLoaded   uint64
+	ObjectsDecompressed uint64
+	BytesCompressed     uint64
+	BytesDecompressed   uint64
+	CacheHits           uint64
+}
+
+// Adds the counters of o
+func (s *ReaderStats) add(o ReaderStats) {
+	s.EntriesRead += o.EntriesRead
+	s.DataObjectsLoaded += o.DataObjectsLoaded
+	s.ObjectsDecompressed += o.ObjectsDecompressed
+	s.BytesCompressed += o.BytesCompressed
+	s.BytesDecompressed += o.BytesDecompressed
+	s.CacheHits += o.CacheHits
+}
+
+// Returns the counters minus those of an earlier snapshot o
+func (s ReaderStats) sub(o ReaderStats) ReaderStats {
+	return ReaderStats{
+		EntriesRead:         s.EntriesRead - o.EntriesRead,
+		DataObjectsLoaded:   s.DataObjectsLoaded - o.DataObjectsLoaded,
+		ObjectsDecompressed: s.ObjectsDecompressed - o.ObjectsDecompressed,
+		BytesCompressed:     s.BytesCompressed - o.BytesCompressed,
+		BytesDecompressed:   s.BytesDecompressed - o.BytesDecompressed,
+		CacheHits:           s.CacheHits - o.CacheHits,
+	}
+}
+
+/*
+ * Returns the counters of the reader. They are plain fields updated as
+ * the reader goes, like the rest of its state they must not be read
+ * while another goroutine uses the reader.
+ *
+ * Clone() starts over from zero, Follow() keeps counting across
+ * rotations.
+ */
+func (j *SdjournalReader) Stats() ReaderStats {
+	return j.stats
+}
+
+/*
+ * Occupancy of the data and field hash tables, as returned by
+ * HashTableStats(). The load factor is items per bucket, journald
+ * rotates a file once it reaches 0.75. Fields the header predates are 0.
+ */
+type HashStats struct {
+	DataBuckets     uint64
+	DataItems       uint64
+	DataLoad        float64
+	DataChainDepth  uint64
+	FieldBuckets    uint64
+	FieldItems      uint64
+	FieldLoad       float64
+	FieldChainDepth uint64
+}
+
+/*
+ * Reports the sizes of the hash tables against the number of objects in
+ * them, from the header alone. High load factors explain long hash
+ * chains and slow lookups, see also HashTableHealth().
+ */
+func (j *SdjournalReader) HashTableStats() (HashStats, error) {
+	var s HashStats
+
+	if !j.opened {
+		return s, fmt.Errorf("This object hasn't been opened")
+	}
+
+	h := j.header
+	s.DataBuckets = h.data_hash_table_size / HASH_ITEM_SIZE
+	s.FieldBuckets = h.field_hash_table_size / HASH_ITEM_SIZE
+
+	if j._headerHas(unsafe.Offsetof(h.n_data) + 8) {
+		s.DataItems = h.n_data
+	}
+	if j._headerHas(unsafe.Offsetof(h.n_fields) + 8) {
+		s.FieldItems = h.n_fields
+	}
+	if j._headerHas(unsafe.Offsetof(h.data_hash_chain_depth) + 8) {
+		s.DataChainDepth = h.data_hash_chain_depth
+	}
+	if j._headerHas(unsafe.Offsetof(h.field_hash_chain_depth) + 8) {
+		s.FieldChainDepth = h.field_hash_chain_depth
+	}
+
+	if s.DataBuckets > 0 {
+		s.DataLoad = float64(s.DataItems) / float64(s.DataBuckets)
+	}
+	if s.FieldBuckets > 0 {
+		s.FieldLoad = float64(s.FieldItems) / float64(s.FieldBuckets)
+	}
+	return s, nil
+}
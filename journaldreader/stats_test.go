@@ -0,0 +1,44 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"testing"
+)
+
+func TestCompressionStats(t *testing.T) {
+	for _, name := range []string{"regular.journal", "compact.journal"} {
+		j := open_fixture(t, name)
+		s, err := j.CompressionStats()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if s.Uncompressed.Objects+s.ZSTD.Objects != j.header.n_data {
+			t.Fatalf("%s: counted %d data objects, the header has %d", name, s.Uncompressed.Objects+s.ZSTD.Objects, j.header.n_data)
+		}
+
+		// Only the long MESSAGE is compressed
+		message := s.Fields["MESSAGE"]
+		if s.ZSTD.Objects != 1 || message.ZSTD != s.ZSTD {
+			t.Fatalf("%s: %+v ZSTD compressed, %+v of them MESSAGE, want just one", name, s.ZSTD, message.ZSTD)
+		}
+		if s.ZSTD.Decompressed != uint64(len("MESSAGE="))+2004 || s.Ratio() <= 1 {
+			t.Fatalf("%s: ZSTD payloads decompress to %d bytes, ratio %f", name, s.ZSTD.Decompressed, s.Ratio())
+		}
+
+		var total CompressionCount
+		for _, c := range s.Fields {
+			total.Objects += c.Uncompressed.Objects + c.ZSTD.Objects
+			total.Bytes += c.Uncompressed.Bytes + c.ZSTD.Bytes
+		}
+		if total.Objects != j.header.n_data || total.Bytes != s.Uncompressed.Bytes+s.ZSTD.Bytes {
+			t.Fatalf("%s: the fields add up to %+v", name, total)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
+
+type textReader struct {
+	j   *SdjournalReader
+	buf bytes.Buffer
+	err error
+}
+
+/*
+ * Returns a reader producing the entries as text, one line per entry
+ * like journalctl's short format:
+ *
+ *	Oct 16 16:44:16 host ident[pid]: message
+ *
+ * The timestamp is in local time. The hostname is left out when missing,
+ * the identifier falls back to _COMM and then "unknown", and the pid to
+ * SYSLOG_PID. Further lines of multi-line messages are indented under the
+ * first one.
+ *
+ * Entries are read with NextEntry() as the text is consumed, so filters
+ * apply. Errors are returned by Read().
+ */
+func (j *SdjournalReader) TextReader() io.Reader {
+	return &textReader{j: j}
+}
+
+func (r *textReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && r.err == nil {
+		entry, ok, err := r.j.NextEntry()
+		if err != nil {
+			r.err = err
+		} else if !ok {
+			r.err = io.EOF
+		} else {
+			format_short(&r.buf, entry)
+		}
+	}
+
+	if r.buf.Len() > 0 {
+		return r.buf.Read(p)
+	}
+	return 0, r.err
+}
+
+func format_short(buf *bytes.Buffer, entry *Entry) {
+	start := buf.Len()
+
+	t := time.UnixMicro(int64(entry.Realtime))
+	buf.WriteString(t.Format("Jan 02 15:04:05"))
+
+	if host, ok := entry.Fields["_HOSTNAME"]; ok {
+		buf.WriteByte(' ')
+		buf.WriteString(host)
+	}
+
+	buf.WriteByte(' ')
+	if ident, ok := entry.Fields["SYSLOG_IDENTIFIER"]; ok {
+		buf.WriteString(ident)
+	} else if comm, ok := entry.Fields["_COMM"]; ok {
+		buf.WriteString(comm)
+	} else {
+		buf.WriteString("unknown")
+	}
+
+	if pid, ok := entry.Fields["_PID"]; ok {
+		buf.WriteString("[" + pid + "]")
+	} else if pid, ok := entry.Fields["SYSLOG_PID"]; ok {
+		buf.WriteString("[" + pid + "]")
+	}
+	buf.WriteString(": ")
+
+	indent := strings.Repeat(" ", buf.Len()-start)
+	message := strings.TrimRight(entry.Fields["MESSAGE"], "\n")
+	buf.WriteString(strings.ReplaceAll(message, "\n", "\n"+indent))
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,132 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MESSAGE_ID of the entries systemd-coredump logs for a crash
+const MESSAGE_ID_COREDUMP = "fc2e22bc6ee647b6b90729ab34a250b1"
+
+var unit_suffixes = []string{
+	".service", ".socket", ".target", ".device", ".mount", ".automount",
+	".swap", ".timer", ".path", ".slice", ".scope",
+}
+
+/*
+ * Completes a unit name the way journalctl does, names without a unit
+ * type suffix are services.
+ */
+func mangle_unit_name(unit string) (string, error) {
+	if unit == "" || strings.ContainsAny(unit, "/=\n") {
+		return "", fmt.Errorf("Invalid unit name %q", unit)
+	}
+	if path.Ext(unit) != "" {
+		for _, suffix := range unit_suffixes {
+			if strings.HasSuffix(unit, suffix) {
+				return unit, nil
+			}
+		}
+	}
+	return unit + ".service", nil
+}
+
+/*
+ * Adds each group of field=value matches as a disjunction of its own,
+ * ANDed with the matches of the current group, which the groups replace.
+ * A field in both keeps the values common to the two, as an entry has
+ * the unit fields once. A group left without a value for a field can't
+ * match, it is kept rather than dropped so that when all the groups
+ * conflict with the matches no entry is returned, rather than all.
+ */
+func (j *SdjournalReader) _addMatchGroups(groups [][][2]string) {
+	base := j.matches
+	j.matches = nil
+
+	for _, group := range groups {
+		matches := make(map[string][]string)
+		for _, m := range group {
+			matches[m[0]] = append(matches[m[0]], m[1])
+		}
+
+		for field, values := range base {
+			if matches[field] == nil {
+				matches[field] = slices.Clone(values)
+				continue
+			}
+			matches[field] = slices.DeleteFunc(matches[field], func(v string) bool {
+				return !slices.Contains(values, v)
+			})
+		}
+		j.disjunctions = append(j.disjunctions, matches)
+	}
+	j._filtersChanged()
+}
+
+/*
+ * Only return entries about the system unit, like journalctl -u: the
+ * ones logged by the unit, its coredumps, the messages of systemd about
+ * it and those of privileged daemons naming it in OBJECT_SYSTEMD_UNIT.
+ * For a slice the entries of all units in it are included too. A name
+ * without a type suffix is taken as a service.
+ *
+ * Matches added before, in the current group, are ANDed with the unit
+ * ones, like journalctl -u UNIT FIELD=VALUE. The unit matches close the
+ * group: calling ForUnit() again adds another unit, ORed with the first,
+ * like repeating -u does, matches to AND with it have to be added again
+ * before. Groups closed with AddDisjunction() before are ORed as usual.
+ * SetMaxPriority() applies as well.
+ */
+func (j *SdjournalReader) ForUnit(unit string) error {
+	unit, err := mangle_unit_name(unit)
+	if err != nil {
+		return err
+	}
+
+	groups := [][][2]string{
+		{{"_SYSTEMD_UNIT", unit}},
+		{{"MESSAGE_ID", MESSAGE_ID_COREDUMP}, {"_UID", "0"}, {"COREDUMP_UNIT", unit}},
+		{{"_PID", "1"}, {"UNIT", unit}},
+		{{"_UID", "0"}, {"OBJECT_SYSTEMD_UNIT", unit}},
+	}
+	if strings.HasSuffix(unit, ".slice") {
+		groups = append(groups, [][2]string{{"_SYSTEMD_SLICE", unit}})
+	}
+	j._addMatchGroups(groups)
+	return nil
+}
+
+/*
+ * Like ForUnit() for a unit of the user manager of uid, like journalctl
+ * --user-unit does for the calling user. Only entries logged by uid, or
+ * by root about the unit, are returned.
+ */
+func (j *SdjournalReader) ForUserUnit(unit string, uid uint32) error {
+	unit, err := mangle_unit_name(unit)
+	if err != nil {
+		return err
+	}
+
+	u := strconv.FormatUint(uint64(uid), 10)
+	groups := [][][2]string{
+		{{"_SYSTEMD_USER_UNIT", unit}, {"_UID", u}},
+		{{"USER_UNIT", unit}, {"_UID", u}},
+		{{"COREDUMP_USER_UNIT", unit}, {"_UID", u}, {"_UID", "0"}},
+		{{"OBJECT_SYSTEMD_USER_UNIT", unit}, {"_UID", u}, {"_UID", "0"}},
+	}
+	if strings.HasSuffix(unit, ".slice") {
+		groups = append(groups, [][2]string{{"_SYSTEMD_USER_SLICE", unit}, {"_UID", u}})
+	}
+	j._addMatchGroups(groups)
+	return nil
+}
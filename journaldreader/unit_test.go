@@ -0,0 +1,59 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"testing"
+)
+
+/*
+ * Every group of ForUserUnit() requires _UID=7, ANDed with _UID=5 none
+ * can match. The reader must return no entry, not fall back to all.
+ */
+func TestForUserUnitConflictingMatches(t *testing.T) {
+	j := open_fixture(t, "regular.journal")
+	err := j.AddMatch("_UID", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = j.ForUserUnit("app.service", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := read_all(t, j)
+	if len(entries) != 0 {
+		t.Fatalf("Read %d entries, want none", len(entries))
+	}
+}
+
+// The matches are still ANDed with the groups they don't conflict with
+func TestForUnitWithMatches(t *testing.T) {
+	j := open_fixture(t, "regular.journal")
+	err := j.AddMatch("_UID", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = j.ForUnit("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j.disjunctions) != 4 {
+		t.Fatalf("%d disjunctions, want 4", len(j.disjunctions))
+	}
+	for _, matches := range j.disjunctions {
+		if len(matches["_UID"]) != 1 || matches["_UID"][0] != "0" {
+			t.Fatalf("Group %v, want _UID=0 only", matches)
+		}
+	}
+
+	entries := read_all(t, j)
+	if len(entries) != 0 {
+		t.Fatalf("Read %d entries, the fixture has no units", len(entries))
+	}
+}
@@ -0,0 +1,174 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+ * Returned by Verify() for an online file whose structure is otherwise
+ * fine. Its n_entries and tail_object_offset may be stale.
+ */
+var ErrJournalOnline = errors.New("The journal is online, it is being written to or was not closed cleanly")
+
+// Checks that a complete object of the given type is present at offset
+func (j *SdjournalReader) _verifyObject(offset uint64, type_ uint8) error {
+	if (offset & 7) != 0 {
+		return fmt.Errorf("Object at %d is not 8-byte aligned", offset)
+	}
+
+	buf, err := j._slice(offset, OBJECT_HEADER_SIZE)
+	if err != nil {
+		return fmt.Errorf("Object at %d is past the end of the file", offset)
+	}
+	h := decode_object_header(buf)
+
+	if h.type_ != type_ {
+		return fmt.Errorf("Object at %d is of type %s, expected %s", offset, object_type_name(h.type_), object_type_name(type_))
+	}
+	return j._checkObjectSize(offset, h, OBJECT_HEADER_SIZE)
+}
+
+/*
+ * Checks that the hash stored in the data object matches its payload.
+ *
+ * This catches both corrupt payloads and files whose hash function
+ * (Jenkins or keyed SipHash) is not the one the header flags announce.
+ */
+func (j *SdjournalReader) _verifyDataHash(offset uint64) error {
+	h, _, err := j._loadDataObject(offset)
+	if err != nil {
+		return err
+	}
+
+	// Payloads that can't be decompressed yet can't be hashed either
+	if h.object.flags&OBJECT_COMPRESSED_XZ != 0 {
+		return nil
+	}
+
+	buf, err := j._loadData(offset)
+	if err != nil {
+		return err
+	}
+
+	hash := j.hashPayload(buf)
+	if hash != h.hash {
+		return fmt.Errorf("Data object at %d has hash %016x, its payload hashes to %016x", offset, h.hash, hash)
+	}
+	return nil
+}
+
+/*
+ * Checks the structure of the file before reading it, returning the
+ * first inconsistency found.
+ *
+ * This checks that the tail object lies within the arena, walks the
+ * entry array chain checking that every array, entry and data object
+ * referenced is aligned and within the file, that the data objects hash
+ * to their stored hash, that the entries' seqnums strictly increase,
+ * and that the number of entries found matches the header.
+ *
+ * For an online file ErrJournalOnline is returned when nothing else is
+ * wrong, and other errors mention that the file is online, since a
+ * writer may be changing it while it is checked.
+ */
+func (j *SdjournalReader) Verify() error {
+	if !j.opened {
+		return fmt.Errorf("This object hasn't been opened")
+	}
+
+	err := j._verify()
+	if j.header.state != STATE_ONLINE {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w (the journal is online)", err)
+	}
+	return ErrJournalOnline
+}
+
+func (j *SdjournalReader) _verify() error {
+	h := j.header
+
+	arena_end := h.header_size + h.arena_size
+	if arena_end < h.header_size || arena_end > j.size {
+		return fmt.Errorf("Arena of %d bytes after the %d byte header runs past the end of the file", h.arena_size, h.header_size)
+	}
+	if h.tail_object_offset != 0 && (h.tail_object_offset < h.header_size || h.tail_object_offset >= arena_end) {
+		return fmt.Errorf("Tail object offset %d is outside the arena", h.tail_object_offset)
+	}
+
+	n_entries := uint64(0)
+	last_seqnum := uint64(0)
+
+	// Data objects are shared by many entries, check each one once
+	hashed := make(map[uint64]bool)
+
+	array_offset := h.entry_array_offset
+	for array_offset != 0 {
+		err := j._verifyObject(array_offset, OBJECT_ENTRY_ARRAY)
+		if err != nil {
+			return err
+		}
+		array, items, err := j._entryArrayAt(array_offset)
+		if err != nil {
+			return fmt.Errorf("Entry array at %d: %w", array_offset, err)
+		}
+
+		n := j._entryArrayUsed(array, items)
+		for i := uint64(0); i < n; i++ {
+			entry_offset := j._entryArrayItem(items, i)
+
+			err = j._verifyObject(entry_offset, OBJECT_ENTRY)
+			if err != nil {
+				return err
+			}
+			entry, err := j._loadEntryObject(entry_offset)
+			if err != nil {
+				return fmt.Errorf("Entry at %d: %w", entry_offset, err)
+			}
+			if n_entries > 0 && entry.seqnum <= last_seqnum {
+				return fmt.Errorf("Entry at %d has seqnum %d, not after the previous entry's %d", entry_offset, entry.seqnum, last_seqnum)
+			}
+			last_seqnum = entry.seqnum
+
+			data, err := j._loadDataOffsetsFromEntry(entry_offset)
+			if err != nil {
+				return fmt.Errorf("Entry at %d: %w", entry_offset, err)
+			}
+			for _, data_offset := range data {
+				err = j._verifyObject(data_offset, OBJECT_DATA)
+				if err != nil {
+					return fmt.Errorf("Entry at %d: %w", entry_offset, err)
+				}
+				if hashed[data_offset] {
+					continue
+				}
+				err = j._verifyDataHash(data_offset)
+				if err != nil {
+					return fmt.Errorf("Entry at %d: %w", entry_offset, err)
+				}
+				hashed[data_offset] = true
+			}
+			n_entries++
+		}
+
+		array_offset, err = _nextEntryArray(array_offset, array)
+		if err != nil {
+			return err
+		}
+	}
+
+	if n_entries != h.n_entries {
+		return fmt.Errorf("Found %d entries but the header says %d", n_entries, h.n_entries)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+/* SPDX-License-Identifier: LGPL-2.1-or-later */
+
+/*
+ * Copyright for the go version:
+ *
+ * 2024 Appgate Inc.
+ */
+package journaldreader
+
+/*
+ * Like Open() but only returns the entries with a realtime timestamp
+ * between start and end, inclusive, like journalctl --since and --until.
+ *
+ * The iterator is placed at start by bisecting the entry arrays and the
+ * iteration ends at the first entry past end, so only the pages of the
+ * window are read. With SetAccessPattern(ACCESS_RANDOM) the kernel
+ * doesn't read ahead around them either, which keeps queries on large
+ * archived files cheap. Reset() goes back to the start of the window.
+ *
+ * Like the other realtime seeks this relies on the timestamps growing
+ * through the file, entries written after the clock was set back may be
+ * missed.
+ */
+func (j *SdjournalReader) OpenWindow(journalfile string, startRealtime, endRealtime uint64) error {
+	err := j.Open(journalfile)
+	if err != nil {
+		return err
+	}
+
+	j.has_window = true
+	j.window_start = startRealtime
+	j.window_end = endRealtime
+
+	err = j._seekWindowStart()
+	if err != nil {
+		j.Close()
+		return err
+	}
+	return nil
+}
+
+func (j *SdjournalReader) _seekWindowStart() error {
+	j.last_entry_offset = 0
+	j.peeked = nil
+	return j._seekFirst(func(h *EntryObject) bool {
+		return h.realtime < j.window_start
+	})
+}
+
+/*
+ * Reports whether the entry just returned by _next_entry_offset() is past
+ * the end of the window. It is then put back, so that the iteration
+ * stays at the end.
+ */
+func (j *SdjournalReader) _windowEnded(offset uint64) (bool, error) {
+	h, err := j._loadEntryObject(offset)
+	if err != nil {
+		return false, err
+	}
+	if h.realtime <= j.window_end {
+		return false, nil
+	}
+	j.array_iterator--
+	return true, nil
+}